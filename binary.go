@@ -0,0 +1,254 @@
+package hashsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// treeFormatVersion is the version byte written by MarshalBinary
+// and checked by UnmarshalBinary.
+// It exists so that future, incompatible changes to the wire format
+// can be detected instead of silently misparsed.
+const treeFormatVersion = 1
+
+// DefaultKeyWidth is the key width [TreeNode.MarshalBinary] uses
+// when the caller doesn't specify one with [TreeNode.MarshalBinaryKeyWidth]:
+// zero, meaning each leaf chunk is individually length-prefixed
+// rather than encoded at some fixed width.
+const DefaultKeyWidth = 0
+
+// MarshalBinary encodes n and its descendants in hashsplit's canonical binary tree format,
+// suitable for storage, transmission, and later decoding with UnmarshalBinary.
+//
+// The format records, per node, its offset and size, and then either
+// (for a level-0 node) its chunks, or (for a higher-level node) its children, recursively.
+// Chunks are typically save-aside keys rather than raw content
+// (see [Build] and [NewReader]) and are encoded with a length prefix.
+// To encode them at a fixed width instead — more compact when every key
+// is the same size, e.g. a 32-byte SHA-256 digest — use [TreeNode.MarshalBinaryKeyWidth].
+func (n *TreeNode) MarshalBinary() ([]byte, error) {
+	return n.MarshalBinaryKeyWidth(DefaultKeyWidth)
+}
+
+// MarshalBinaryKeyWidth is like MarshalBinary,
+// but encodes each leaf chunk as a fixed-width field of keyWidth bytes
+// instead of length-prefixing it individually.
+// A keyWidth of zero means "length-prefix each chunk" (the behavior of MarshalBinary).
+// It is an error for keyWidth to be positive
+// if some chunk does not have exactly that length.
+func (n *TreeNode) MarshalBinaryKeyWidth(keyWidth int) ([]byte, error) {
+	if keyWidth < 0 || keyWidth > 255 {
+		return nil, fmt.Errorf("hashsplit: key width %d out of range", keyWidth)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(treeFormatVersion)
+	buf.WriteByte(byte(keyWidth))
+	if err := n.encode(&buf, keyWidth); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Node kinds, written as a single byte before each node's payload.
+const (
+	nodeKindLeaf     = 0
+	nodeKindInterior = 1
+)
+
+func (n *TreeNode) encode(buf *bytes.Buffer, keyWidth int) error {
+	putUint64(buf, n.Offset)
+	putUint64(buf, n.Size)
+
+	if len(n.Children) == 0 {
+		buf.WriteByte(nodeKindLeaf)
+		putUvarint(buf, uint64(len(n.Chunks)))
+		for _, chunk := range n.Chunks {
+			if keyWidth == 0 {
+				putUvarint(buf, uint64(len(chunk)))
+				buf.Write(chunk)
+				continue
+			}
+			if len(chunk) != keyWidth {
+				return fmt.Errorf("hashsplit: chunk key has length %d, want %d", len(chunk), keyWidth)
+			}
+			buf.Write(chunk)
+		}
+		return nil
+	}
+
+	buf.WriteByte(nodeKindInterior)
+	putUvarint(buf, uint64(len(n.Children)))
+	for _, child := range n.Children {
+		if err := child.encode(buf, keyWidth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putUint64(buf *bytes.Buffer, v uint64) {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	buf.Write(tmp[:])
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// UnmarshalBinary decodes a tree previously encoded with MarshalBinary or MarshalBinaryKeyWidth,
+// replacing n's contents with the decoded tree's.
+func (n *TreeNode) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading format version: %w", err)
+	}
+	if version != treeFormatVersion {
+		return fmt.Errorf("hashsplit: unsupported tree format version %d", version)
+	}
+
+	keyWidthByte, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading key width: %w", err)
+	}
+
+	decoded, err := decodeNode(r, int(keyWidthByte))
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("hashsplit: %d trailing bytes after tree", r.Len())
+	}
+
+	*n = *decoded
+	return nil
+}
+
+func decodeNode(r *bytes.Reader, keyWidth int) (*TreeNode, error) {
+	offset, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading offset: %w", err)
+	}
+	size, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading size: %w", err)
+	}
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading node kind: %w", err)
+	}
+
+	n := &TreeNode{Offset: offset, Size: size}
+
+	switch kind {
+	case nodeKindLeaf:
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("hashsplit: reading chunk count: %w", err)
+		}
+		for i := uint64(0); i < count; i++ {
+			chunk, err := readChunk(r, keyWidth)
+			if err != nil {
+				return nil, fmt.Errorf("hashsplit: reading chunk %d: %w", i, err)
+			}
+			n.Chunks = append(n.Chunks, chunk)
+		}
+
+	case nodeKindInterior:
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("hashsplit: reading child count: %w", err)
+		}
+		for i := uint64(0); i < count; i++ {
+			child, err := decodeNode(r, keyWidth)
+			if err != nil {
+				return nil, fmt.Errorf("hashsplit: reading child %d: %w", i, err)
+			}
+			n.Children = append(n.Children, child)
+		}
+
+	default:
+		return nil, fmt.Errorf("hashsplit: unknown node kind %d", kind)
+	}
+
+	return n, nil
+}
+
+func readChunk(r *bytes.Reader, keyWidth int) ([]byte, error) {
+	if keyWidth == 0 {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		chunk := make([]byte, l)
+		_, err = io.ReadFull(r, chunk)
+		return chunk, err
+	}
+	chunk := make([]byte, keyWidth)
+	_, err := io.ReadFull(r, chunk)
+	return chunk, err
+}
+
+func getUint64(r *bytes.Reader) (uint64, error) {
+	var tmp [8]byte
+	if _, err := io.ReadFull(r, tmp[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(tmp[:]), nil
+}
+
+// WriteTree writes root to w in the canonical binary tree format
+// (see [TreeNode.MarshalBinary]), preceded by a length prefix
+// so that [ReadTree] knows how much to read back.
+func WriteTree(w io.Writer, root *TreeNode) error {
+	return WriteTreeKeyWidth(w, root, DefaultKeyWidth)
+}
+
+// WriteTreeKeyWidth is like WriteTree but encodes leaf chunk keys at a fixed width;
+// see [TreeNode.MarshalBinaryKeyWidth].
+func WriteTreeKeyWidth(w io.Writer, root *TreeNode, keyWidth int) error {
+	data, err := root.MarshalBinaryKeyWidth(keyWidth)
+	if err != nil {
+		return err
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return fmt.Errorf("hashsplit: writing tree length: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("hashsplit: writing tree: %w", err)
+	}
+	return nil
+}
+
+// ReadTree reads a tree previously written with WriteTree or WriteTreeKeyWidth.
+func ReadTree(r io.Reader) (*TreeNode, error) {
+	br := bufio.NewReader(r)
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading tree length: %w", err)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return nil, fmt.Errorf("hashsplit: reading tree: %w", err)
+	}
+
+	var n TreeNode
+	if err := n.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
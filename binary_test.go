@@ -0,0 +1,86 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func genText() []byte {
+	return []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 5000))
+}
+
+func TestTreeBinaryRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	split, errptr := Split(ctx, bytes.NewReader(text))
+	tree, treeErrptr := Tree(ctx, split)
+	root := Root(tree)
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if err := *treeErrptr; err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := root.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got TreeNode
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(root, &got); diff != "" {
+		t.Errorf("mismatch after round trip (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteReadTree(t *testing.T) {
+	text := genText()
+
+	store := make(mapStore)
+	root, err := Build(context.Background(), bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTreeKeyWidth(&buf, root, sha256.Size); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadTree(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(root, got); diff != "" {
+		t.Errorf("mismatch after round trip (-want +got):\n%s", diff)
+	}
+
+	r := NewReader(got, store)
+	defer r.Close()
+
+	var reconstructed bytes.Buffer
+	if _, err := reconstructed.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reconstructed.Bytes(), text) {
+		t.Fatal("reconstructed content does not match original")
+	}
+}
+
+func TestMarshalBinaryKeyWidthMismatch(t *testing.T) {
+	n := &TreeNode{Chunks: [][]byte{{1, 2, 3}}}
+	if _, err := n.MarshalBinaryKeyWidth(32); err == nil {
+		t.Fatal("expected an error for a chunk that doesn't match the key width")
+	}
+}
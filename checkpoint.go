@@ -0,0 +1,152 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/chmduquesne/rollinghash/buzhash32"
+)
+
+// Checkpoint captures s's internal state -- its settings, the rolling
+// checksum window, the in-progress chunk buffer, and the number of bytes
+// consumed so far -- so that [RestoreSplitter] can later reconstruct a
+// Splitter that resumes hashsplitting exactly where s left off.
+//
+// A Checkpoint taken from inside the yield callback of [Splitter.Split]
+// (as [Splitter.SplitResumable] does) sees an empty in-progress chunk buffer,
+// since the chunk just yielded is already closed -- except for the final
+// chunk at the end of the stream, which Split yields without clearing the
+// buffer, so a Splitter restored from such a checkpoint yields that chunk again.
+func (s *Splitter) Checkpoint() ([]byte, error) {
+	if s.Hasher != HasherBuzhash {
+		return nil, fmt.Errorf("hashsplit: Checkpoint is not supported for Hasher %v", s.Hasher)
+	}
+
+	var buf bytes.Buffer
+
+	putUint64(&buf, uint64(s.MinSize))
+	putUint64(&buf, uint64(s.SplitBits))
+	putUint64(&buf, uint64(s.MaxSize))
+	putUint64(&buf, s.consumed)
+	putUint64(&buf, uint64(s.widx))
+	buf.Write(s.window[:])
+
+	putUvarint(&buf, uint64(len(s.chunk)))
+	buf.Write(s.chunk)
+
+	return buf.Bytes(), nil
+}
+
+// RestoreSplitter reconstructs a Splitter from a checkpoint produced by
+// [Splitter.Checkpoint], ready to resume hashsplitting a stream at the byte
+// position immediately following wherever the checkpoint was taken.
+// The caller is responsible for supplying [Splitter.Split] with a reader
+// that picks up at that same position.
+func RestoreSplitter(data []byte) (*Splitter, error) {
+	r := bytes.NewReader(data)
+
+	minSize, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading MinSize: %w", err)
+	}
+	splitBits, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading SplitBits: %w", err)
+	}
+	maxSize, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading MaxSize: %w", err)
+	}
+	consumed, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading consumed byte count: %w", err)
+	}
+	widx, err := getUint64(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading window index: %w", err)
+	}
+
+	var window [windowSize]byte
+	if _, err := io.ReadFull(r, window[:]); err != nil {
+		return nil, fmt.Errorf("hashsplit: reading rolling checksum window: %w", err)
+	}
+
+	chunkLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading chunk buffer length: %w", err)
+	}
+	chunk := make([]byte, chunkLen)
+	if _, err := io.ReadFull(r, chunk); err != nil {
+		return nil, fmt.Errorf("hashsplit: reading chunk buffer: %w", err)
+	}
+
+	s := &Splitter{
+		MinSize:   int(minSize),
+		SplitBits: int(splitBits),
+		MaxSize:   int(maxSize),
+		chunk:     chunk,
+		window:    window,
+		widx:      int(widx),
+		consumed:  consumed,
+	}
+
+	// Reconstruct the rolling checksum by priming a fresh buzhash32 with the
+	// window contents in oldest-to-newest order, which is exactly what Write
+	// leaves Roll to continue from.
+	ordered := make([]byte, windowSize)
+	for i := range ordered {
+		ordered[i] = s.window[(s.widx+i)%windowSize]
+	}
+	rs := buzhash32.New()
+	if _, err := rs.Write(ordered); err != nil {
+		return nil, fmt.Errorf("hashsplit: priming rolling checksum: %w", err)
+	}
+	s.rs = rs
+
+	return s, nil
+}
+
+// SplitResumable is like [Splitter.Split],
+// except it also calls ckpt with a checkpoint (see [Splitter.Checkpoint])
+// every time at least `every` bytes have been consumed since the last one,
+// always right after a chunk has been yielded --
+// the only point at which the rolling window state is well defined
+// independent of a partially accumulated next chunk.
+//
+// If ckpt returns an error, SplitResumable stops early
+// and that error is returned through the same *error Split returns.
+// A zero `every` disables checkpointing; SplitResumable then behaves like Split.
+//
+// SplitResumable honors ctx exactly as [Splitter.Split] does.
+func (s *Splitter) SplitResumable(ctx context.Context, r io.Reader, ckpt func([]byte) error, every uint64) (iter.Seq2[[]byte, int], *error) {
+	split, errptr := s.Split(ctx, r)
+
+	var lastCkpt uint64
+
+	f := func(yield func([]byte, int) bool) {
+		for chunk, level := range split {
+			if !yield(chunk, level) {
+				return
+			}
+			if every == 0 || s.consumed-lastCkpt < every {
+				continue
+			}
+			data, err := s.Checkpoint()
+			if err != nil {
+				*errptr = err
+				return
+			}
+			if err := ckpt(data); err != nil {
+				*errptr = err
+				return
+			}
+			lastCkpt = s.consumed
+		}
+	}
+
+	return f, errptr
+}
@@ -0,0 +1,159 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"iter"
+	"testing"
+)
+
+func TestSplitterCheckpointRestore(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	s := NewSplitter()
+	s.SplitBits = 10
+
+	var checkpoints [][]byte
+	split, errptr := s.SplitResumable(ctx, bytes.NewReader(text), func(data []byte) error {
+		checkpoints = append(checkpoints, data)
+		return nil
+	}, 1000)
+
+	var all [][]byte
+	for chunk := range split {
+		all = append(all, bytes.Clone(chunk))
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) == 0 {
+		t.Fatal("expected at least one checkpoint")
+	}
+
+	// Resume from partway through, and check that everything from that point
+	// on matches what the uninterrupted run produced.
+	mid := len(checkpoints) / 2
+	restored, err := RestoreSplitter(checkpoints[mid])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumedSplit, errptr2 := restored.Split(ctx, bytes.NewReader(text[restored.consumed:]))
+
+	var resumed [][]byte
+	for chunk := range resumedSplit {
+		resumed = append(resumed, bytes.Clone(chunk))
+	}
+	if err := *errptr2; err != nil {
+		t.Fatal(err)
+	}
+
+	// Find where, in the uninterrupted run's output, the checkpointed byte
+	// offset falls, and compare the tail against the resumed output.
+	var offset uint64
+	var splitIdx int
+	for i, chunk := range all {
+		if offset == restored.consumed {
+			splitIdx = i
+			break
+		}
+		offset += uint64(len(chunk))
+	}
+
+	if len(resumed) != len(all)-splitIdx {
+		t.Fatalf("got %d resumed chunks, want %d", len(resumed), len(all)-splitIdx)
+	}
+	for i, chunk := range resumed {
+		if !bytes.Equal(chunk, all[splitIdx+i]) {
+			t.Fatalf("resumed chunk %d mismatch", i)
+		}
+	}
+}
+
+type chunkLevel struct {
+	chunk []byte
+	level int
+}
+
+func seqOf(pairs []chunkLevel) iter.Seq2[[]byte, int] {
+	return func(yield func([]byte, int) bool) {
+		for _, p := range pairs {
+			if !yield(p.chunk, p.level) {
+				return
+			}
+		}
+	}
+}
+
+func TestTreeBuilderCheckpointRestore(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	split, errptr := Split(ctx, bytes.NewReader(text))
+
+	var pairs []chunkLevel
+	for chunk, level := range split {
+		pairs = append(pairs, chunkLevel{chunk: bytes.Clone(chunk), level: level})
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+
+	wantTree, wantErrptr := Tree(ctx, seqOf(pairs))
+	want := Root(wantTree)
+	if err := *wantErrptr; err != nil {
+		t.Fatal(err)
+	}
+
+	// Build the same tree in two pieces, joined by a checkpoint taken mid-stream.
+	half := len(pairs) / 2
+
+	b1 := NewTreeBuilder()
+	tree1, errptr1 := b1.Tree(ctx, seqOf(pairs[:half]))
+	for node := range tree1 {
+		_ = node
+	}
+	if err := *errptr1; err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := TreeCheckpoint(b1.Pending())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := RestoreTreeBuilder(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree2, errptr2 := b2.Tree(ctx, seqOf(pairs[half:]))
+	got := Root(tree2)
+	if err := *errptr2; err != nil {
+		t.Fatal(err)
+	}
+
+	if !compareTreeShapes(want, got) {
+		t.Fatal("tree built across a checkpoint has a different shape than the uninterrupted build")
+	}
+}
+
+// compareTreeShapes compares two trees' Offset/Size/Children structure, ignoring chunk content.
+func compareTreeShapes(a, b *TreeNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Offset != b.Offset || a.Size != b.Size {
+		return false
+	}
+	if len(a.Children) != len(b.Children) || len(a.Chunks) != len(b.Chunks) {
+		return false
+	}
+	for i := range a.Children {
+		if !compareTreeShapes(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,307 @@
+// Package chunkedzstd writes and reads a chunk-aligned, randomly seekable
+// archive format built on top of [hashsplit.Splitter]: each hashsplit
+// chunk becomes an independent zstd frame, and a JSON table of contents
+// at the end of the stream records where each frame is and what it
+// decompresses to.
+//
+// This mirrors the design of "chunked" container-image formats: rolling-
+// hash chunk boundaries plus per-chunk compression give two archives of
+// mostly-identical content mostly-identical chunks, and the table of
+// contents gives random access without decompressing the whole archive,
+// and a cheap way ([Diff]) to find which chunks one archive is missing
+// relative to another.
+package chunkedzstd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/bobg/hashsplit/v3"
+)
+
+// Entry describes one chunk in an archive's table of contents.
+type Entry struct {
+	// Offset is the byte offset of this chunk's zstd frame within the archive stream.
+	Offset uint64
+
+	// CompressedLen is the length in bytes of this chunk's zstd frame.
+	CompressedLen uint64
+
+	// UncompressedLen is the length in bytes of this chunk's decompressed content.
+	UncompressedLen uint64
+
+	// UncompressedOffset is the byte offset of this chunk's content
+	// within the original, uncompressed stream.
+	UncompressedOffset uint64
+
+	// Digest is the SHA-256 hash of this chunk's decompressed content.
+	Digest [sha256.Size]byte
+}
+
+// TOC is an archive's table of contents: one [Entry] per chunk, in the
+// order the chunks appear in the archive. [WriteArchive] writes it as a
+// JSON footer; [NewReader] reads it back.
+type TOC struct {
+	Entries []Entry
+}
+
+// totalSize returns the length of the original, uncompressed stream the
+// TOC describes.
+func (t TOC) totalSize() uint64 {
+	if len(t.Entries) == 0 {
+		return 0
+	}
+	last := t.Entries[len(t.Entries)-1]
+	return last.UncompressedOffset + last.UncompressedLen
+}
+
+// WriteArchive hashsplits r with s and writes a chunk-aligned archive to w:
+// each chunk is compressed into its own independent zstd frame, back to
+// back, followed by a JSON-encoded [TOC] footer and an 8-byte
+// little-endian footer length, so [NewReader] can find the footer by
+// reading from the end of the stream without scanning the whole archive.
+//
+// A nil s is equivalent to one returned by [hashsplit.NewSplitter].
+//
+// WriteArchive honors ctx: canceling it stops hashsplitting promptly and
+// WriteArchive returns ctx.Err().
+func WriteArchive(ctx context.Context, w io.Writer, r io.Reader, s *hashsplit.Splitter) error {
+	if s == nil {
+		s = hashsplit.NewSplitter()
+	}
+	split, errptr := s.Split(ctx, r)
+
+	var (
+		toc    TOC
+		offset uint64
+		uoff   uint64
+	)
+
+	for chunk, _ := range split {
+		compressed, err := compressChunk(chunk)
+		if err != nil {
+			return fmt.Errorf("chunkedzstd: compressing chunk: %w", err)
+		}
+		if _, err := w.Write(compressed); err != nil {
+			return fmt.Errorf("chunkedzstd: writing chunk: %w", err)
+		}
+
+		toc.Entries = append(toc.Entries, Entry{
+			Offset:             offset,
+			CompressedLen:      uint64(len(compressed)),
+			UncompressedLen:    uint64(len(chunk)),
+			UncompressedOffset: uoff,
+			Digest:             sha256.Sum256(chunk),
+		})
+
+		offset += uint64(len(compressed))
+		uoff += uint64(len(chunk))
+	}
+	if err := *errptr; err != nil {
+		return err
+	}
+
+	footer, err := json.Marshal(toc)
+	if err != nil {
+		return fmt.Errorf("chunkedzstd: encoding table of contents: %w", err)
+	}
+	if _, err := w.Write(footer); err != nil {
+		return fmt.Errorf("chunkedzstd: writing table of contents: %w", err)
+	}
+
+	var lenBuf [8]byte
+	binary.LittleEndian.PutUint64(lenBuf[:], uint64(len(footer)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return fmt.Errorf("chunkedzstd: writing table of contents length: %w", err)
+	}
+
+	return nil
+}
+
+// compressChunk zstd-compresses chunk into a single, independently
+// decodable frame.
+func compressChunk(chunk []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := enc.Write(chunk); err != nil {
+		enc.Close()
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Reader reconstructs the stream written by [WriteArchive], decompressing
+// only the chunks overlapping each requested range.
+//
+// Reader implements io.ReadSeekCloser.
+// Create one with [NewReader].
+type Reader struct {
+	ra  io.ReaderAt
+	toc TOC
+	dec *zstd.Decoder
+	pos int64
+
+	// cur and buf cache the chunk that most recently satisfied a Read,
+	// to avoid redecompressing it on every call.
+	cur *Entry
+	buf []byte
+}
+
+// NewReader returns a Reader that reconstructs the archive read from ra,
+// which has the given total size in bytes.
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	toc, err := readTOC(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("chunkedzstd: creating decompressor: %w", err)
+	}
+
+	return &Reader{ra: ra, toc: toc, dec: dec}, nil
+}
+
+// readTOC locates and decodes the table of contents footer written by
+// [WriteArchive], by reading its length from the last 8 bytes of the
+// archive and then reading the footer itself from just before that.
+func readTOC(ra io.ReaderAt, size int64) (TOC, error) {
+	if size < 8 {
+		return TOC{}, fmt.Errorf("chunkedzstd: archive of length %d is too short to contain a footer", size)
+	}
+
+	var lenBuf [8]byte
+	if _, err := ra.ReadAt(lenBuf[:], size-8); err != nil {
+		return TOC{}, fmt.Errorf("chunkedzstd: reading table of contents length: %w", err)
+	}
+	footerLen := int64(binary.LittleEndian.Uint64(lenBuf[:]))
+	if footerLen < 0 || footerLen > size-8 {
+		return TOC{}, fmt.Errorf("chunkedzstd: invalid table of contents length %d", footerLen)
+	}
+
+	footer := make([]byte, footerLen)
+	if _, err := ra.ReadAt(footer, size-8-footerLen); err != nil {
+		return TOC{}, fmt.Errorf("chunkedzstd: reading table of contents: %w", err)
+	}
+
+	var toc TOC
+	if err := json.Unmarshal(footer, &toc); err != nil {
+		return TOC{}, fmt.Errorf("chunkedzstd: decoding table of contents: %w", err)
+	}
+	return toc, nil
+}
+
+// TOC returns the archive's table of contents, e.g. to pass to [Diff].
+func (r *Reader) TOC() TOC {
+	return r.toc
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= int64(r.toc.totalSize()) {
+		return 0, io.EOF
+	}
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	off := int(r.pos - int64(r.cur.UncompressedOffset))
+	n := copy(p, r.buf[off:])
+	r.pos += int64(n)
+	return n, nil
+}
+
+// fill ensures r.cur and r.buf describe the chunk covering r.pos,
+// decompressing it if it isn't already cached.
+func (r *Reader) fill() error {
+	if r.cur != nil && r.pos >= int64(r.cur.UncompressedOffset) && r.pos < int64(r.cur.UncompressedOffset+r.cur.UncompressedLen) {
+		return nil
+	}
+
+	e, err := entryFor(r.toc, uint64(r.pos))
+	if err != nil {
+		return err
+	}
+
+	compressed := make([]byte, e.CompressedLen)
+	if _, err := r.ra.ReadAt(compressed, int64(e.Offset)); err != nil {
+		return fmt.Errorf("chunkedzstd: reading chunk: %w", err)
+	}
+
+	buf, err := r.dec.DecodeAll(compressed, make([]byte, 0, e.UncompressedLen))
+	if err != nil {
+		return fmt.Errorf("chunkedzstd: decompressing chunk: %w", err)
+	}
+
+	r.cur, r.buf = e, buf
+	return nil
+}
+
+// entryFor returns the entry in toc whose uncompressed range contains pos.
+func entryFor(toc TOC, pos uint64) (*Entry, error) {
+	for i := range toc.Entries {
+		e := &toc.Entries[i]
+		if pos >= e.UncompressedOffset && pos < e.UncompressedOffset+e.UncompressedLen {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("chunkedzstd: no chunk covers offset %d", pos)
+}
+
+// Seek implements io.Seeker.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = r.pos + offset
+	case io.SeekEnd:
+		newPos = int64(r.toc.totalSize()) + offset
+	default:
+		return 0, fmt.Errorf("chunkedzstd: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, fmt.Errorf("chunkedzstd: negative seek position")
+	}
+	r.pos = newPos
+	return newPos, nil
+}
+
+// Close implements io.Closer. It releases the Reader's decompressor.
+func (r *Reader) Close() error {
+	r.dec.Close()
+	return nil
+}
+
+// Diff compares the tables of contents of two archives produced by
+// [WriteArchive] and returns the entries in b whose chunk digest doesn't
+// appear anywhere in a -- the chunks a client holding archive a would
+// need to fetch to have everything archive b has.
+func Diff(a, b TOC) []Entry {
+	have := make(map[[sha256.Size]byte]bool, len(a.Entries))
+	for _, e := range a.Entries {
+		have[e.Digest] = true
+	}
+
+	var missing []Entry
+	for _, e := range b.Entries {
+		if !have[e.Digest] {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,101 @@
+package chunkedzstd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bobg/hashsplit/v3"
+)
+
+func genText() []byte {
+	return []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 5000))
+}
+
+func TestWriteReadArchive(t *testing.T) {
+	text := genText()
+
+	var archive bytes.Buffer
+	if err := WriteArchive(context.Background(), &archive, bytes.NewReader(text), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, text) {
+		t.Fatal("reconstructed content does not match original")
+	}
+}
+
+func TestReaderSeek(t *testing.T) {
+	text := genText()
+
+	var archive bytes.Buffer
+	s := hashsplit.NewSplitter()
+	s.SplitBits = 10
+	if err := WriteArchive(context.Background(), &archive, bytes.NewReader(text), s); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	mid := int64(len(text) / 2)
+	if _, err := r.Seek(mid, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, text[mid:]) {
+		t.Fatal("seeking mid-stream produced the wrong tail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	textA := []byte(strings.Repeat("alpha beta gamma delta\n", 2000))
+	textB := append(bytes.Clone(textA), []byte(strings.Repeat("epsilon zeta\n", 500))...)
+
+	var archiveA, archiveB bytes.Buffer
+	if err := WriteArchive(context.Background(), &archiveA, bytes.NewReader(textA), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteArchive(context.Background(), &archiveB, bytes.NewReader(textB), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	readerA, err := NewReader(bytes.NewReader(archiveA.Bytes()), int64(archiveA.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readerA.Close()
+	readerB, err := NewReader(bytes.NewReader(archiveB.Bytes()), int64(archiveB.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readerB.Close()
+
+	missing := Diff(readerA.TOC(), readerB.TOC())
+	if len(missing) == 0 {
+		t.Fatal("expected at least one chunk missing from archive A")
+	}
+
+	if diff := Diff(readerA.TOC(), readerA.TOC()); len(diff) != 0 {
+		t.Fatalf("diffing an archive against itself found %d missing chunks, want 0", len(diff))
+	}
+}
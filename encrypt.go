@@ -0,0 +1,290 @@
+package hashsplit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// refKeySize and decryptKeySize are the widths, in bytes,
+// of the two halves of the pair BuildEncrypted stores for each chunk
+// and node it encrypts: the ChunkStore key for the ciphertext,
+// and the key needed to decrypt it.
+const (
+	refKeySize     = sha256.Size
+	decryptKeySize = sha256.Size
+	pairSize       = refKeySize + decryptKeySize
+)
+
+// BuildEncrypted is like [Build],
+// except that every chunk, and every node built above it, is convergently
+// encrypted before it is stored: the encryption key is derived from the
+// plaintext's own SHA-256 hash, so identical plaintext always encrypts to
+// identical ciphertext and dedupes in store just as it would unencrypted.
+//
+// A leaf node's Chunks, and an interior node's list of child references,
+// are themselves serialized (using the same encoding as [RefNode]) and
+// encrypted the same way as a leaf chunk, so that store never sees
+// anything but ciphertext -- not even the shape of the tree. Each node's
+// encryption produces a pairSize-byte value: the key under which its
+// ciphertext was stored, followed by the key needed to decrypt it.
+// Possession of the root pair is sufficient to recover the whole tree.
+//
+// Use [NewDecryptingReader] to reconstruct the original stream from the
+// returned root pair.
+//
+// BuildEncrypted honors ctx exactly as [Build] does.
+func BuildEncrypted(ctx context.Context, r io.Reader, store ChunkStore) ([]byte, error) {
+	split, errptr := Split(ctx, r)
+	tree, treeErrptr := Tree(ctx, split)
+
+	pairs := make(map[*TreeNode][]byte)
+
+	var root []byte
+	for node := range tree {
+		rn := RefNode{Offset: node.Offset, Size: node.Size}
+
+		if len(node.Children) == 0 {
+			for _, chunk := range node.Chunks {
+				pair, err := encryptAndStore(chunk, store)
+				if err != nil {
+					return nil, err
+				}
+				rn.Chunks = append(rn.Chunks, pair)
+			}
+		} else {
+			for _, child := range node.Children {
+				pair, ok := pairs[child]
+				if !ok {
+					return nil, fmt.Errorf("hashsplit: internal error: child node encrypted out of order")
+				}
+				rn.ChildRefs = append(rn.ChildRefs, Ref(pair))
+			}
+		}
+
+		data, err := rn.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pair, err := encryptAndStore(data, store)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs[node] = pair
+		root = pair
+	}
+	if err := *errptr; err != nil {
+		return nil, err
+	}
+	if err := *treeErrptr; err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// encryptAndStore encrypts data with a key convergently derived from its own hash,
+// stores the ciphertext in store, and returns the ref||decryptKey pair
+// needed to retrieve and decrypt it again.
+func encryptAndStore(data []byte, store ChunkStore) ([]byte, error) {
+	key := convergentKey(data)
+
+	ciphertext, err := xorChunk(key, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := store.Put(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: storing encrypted data: %w", err)
+	}
+
+	pair := make([]byte, 0, pairSize)
+	pair = append(pair, ref...)
+	pair = append(pair, key...)
+	return pair, nil
+}
+
+// convergentKey derives a key deterministically from plaintext data,
+// so that identical data always produces the same key (and hence the same ciphertext).
+func convergentKey(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// xorChunk encrypts (or, symmetrically, decrypts) data with AES-CTR under key.
+// The nonce is always the zero block: safe here because key is itself derived
+// from the plaintext, so the (key, nonce) pair is only ever reused
+// for byte-for-byte identical plaintext -- which is the point of convergent encryption.
+func xorChunk(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: creating cipher: %w", err)
+	}
+	var iv [aes.BlockSize]byte
+	stream := cipher.NewCTR(block, iv[:])
+	out := make([]byte, len(data))
+	stream.XORKeyStream(out, data)
+	return out, nil
+}
+
+// decryptAndFetch fetches the ciphertext referenced by the ref half of pair
+// from store and decrypts it with the key half.
+func decryptAndFetch(pair []byte, store ChunkStore) ([]byte, error) {
+	if len(pair) != pairSize {
+		return nil, fmt.Errorf("hashsplit: malformed encrypted reference of length %d, want %d", len(pair), pairSize)
+	}
+	ref, key := pair[:refKeySize], pair[refKeySize:]
+
+	ciphertext, err := store.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	return xorChunk(key, ciphertext)
+}
+
+// fetchEncNode decrypts and decodes the node referenced by pair.
+func fetchEncNode(pair []byte, store ChunkStore) (*RefNode, error) {
+	data, err := decryptAndFetch(pair, store)
+	if err != nil {
+		return nil, err
+	}
+	var n RefNode
+	if err := n.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("hashsplit: decoding encrypted node: %w", err)
+	}
+	return &n, nil
+}
+
+// decryptSeek is the encrypted counterpart to [RefSeek]: it finds the
+// level-0 node representing the given byte position, decrypting from store
+// the nodes on the path from pair down to it, plus, at each level, every
+// child before the one it descends into, to read its range.
+func decryptSeek(pair []byte, store ChunkStore, pos uint64) (*RefNode, error) {
+	node, err := fetchEncNode(pair, store)
+	if err != nil {
+		return nil, err
+	}
+	if pos < node.Offset || pos >= node.Offset+node.Size {
+		return nil, ErrNotFound
+	}
+	if len(node.ChildRefs) == 0 {
+		return node, nil
+	}
+
+	for _, childPair := range node.ChildRefs {
+		child, err := fetchEncNode([]byte(childPair), store)
+		if err != nil {
+			return nil, err
+		}
+		if pos < child.Offset+child.Size {
+			return decryptSeek([]byte(childPair), store, pos)
+		}
+	}
+	// With a properly formed tree of nodes this will not be reached.
+	return nil, ErrNotFound
+}
+
+// DecryptingReader reconstructs the original byte stream from a tree built
+// and encrypted by [BuildEncrypted], decrypting each node as the traversal
+// reaches it. Create one with [NewDecryptingReader].
+//
+// DecryptingReader implements io.ReadSeekCloser, the same as [Reader];
+// unlike Reader, every node it touches -- not just the level-0 node
+// overlapping the current position -- must be fetched from store and
+// decrypted, since offsets and sizes above level 0 are themselves
+// encrypted.
+type DecryptingReader struct {
+	root  []byte
+	store ChunkStore
+	size  uint64
+	pos   uint64
+
+	// cur and buf cache the level-0 node (and its decrypted, assembled
+	// bytes) that most recently satisfied a Read, to avoid re-fetching
+	// and re-decrypting on every call.
+	cur *RefNode
+	buf []byte
+}
+
+// NewDecryptingReader returns a DecryptingReader that reconstructs the
+// stream represented by root, a pair returned by [BuildEncrypted],
+// fetching and decrypting nodes from store as needed.
+//
+// Unlike [NewReader], NewDecryptingReader must decrypt the root node to
+// learn the size of the stream, so it can fail before any byte is read.
+func NewDecryptingReader(root []byte, store ChunkStore) (io.ReadSeekCloser, error) {
+	node, err := fetchEncNode(root, store)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptingReader{root: root, store: store, size: node.Size}, nil
+}
+
+// Read implements io.Reader.
+func (r *DecryptingReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	off := int(r.pos - r.cur.Offset)
+	n := copy(p, r.buf[off:])
+	r.pos += uint64(n)
+	return n, nil
+}
+
+// fill ensures r.cur and r.buf describe the level-0 node covering r.pos,
+// decrypting it from r.store if it isn't already cached.
+func (r *DecryptingReader) fill() error {
+	if r.cur != nil && r.pos >= r.cur.Offset && r.pos < r.cur.Offset+r.cur.Size {
+		return nil
+	}
+
+	node, err := decryptSeek(r.root, r.store, r.pos)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, node.Size)
+	for _, pair := range node.Chunks {
+		chunk, err := decryptAndFetch(pair, r.store)
+		if err != nil {
+			return fmt.Errorf("hashsplit: fetching encrypted chunk: %w", err)
+		}
+		buf = append(buf, chunk...)
+	}
+
+	r.cur, r.buf = node, buf
+	return nil
+}
+
+// Seek implements io.Seeker.
+func (r *DecryptingReader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = int64(r.pos) + offset
+	case io.SeekEnd:
+		newPos = int64(r.size) + offset
+	default:
+		return 0, fmt.Errorf("hashsplit: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, errors.New("hashsplit: negative seek position")
+	}
+	r.pos = uint64(newPos)
+	return newPos, nil
+}
+
+// Close implements io.Closer. It is a no-op.
+func (r *DecryptingReader) Close() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestBuildEncrypted(t *testing.T) {
+	text := genText()
+
+	store := make(mapStore)
+	root, err := BuildEncrypted(context.Background(), bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root) != pairSize {
+		t.Fatalf("root reference has length %d, want %d", len(root), pairSize)
+	}
+
+	for _, ciphertext := range store {
+		if bytes.Contains(text, ciphertext) {
+			t.Fatal("store holds plaintext")
+		}
+	}
+
+	r, err := NewDecryptingReader(root, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), text) {
+		t.Fatal("decrypted content does not match original")
+	}
+}
+
+func TestConvergentEncryptionDedupes(t *testing.T) {
+	chunk := []byte("identical content, seen twice")
+
+	pair1, err := encryptAndStore(chunk, make(mapStore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair2, err := encryptAndStore(chunk, make(mapStore))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pair1, pair2) {
+		t.Fatal("identical plaintext produced different ref||key pairs")
+	}
+}
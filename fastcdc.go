@@ -0,0 +1,224 @@
+package hashsplit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/bits"
+)
+
+// Hasher selects the algorithm a [Splitter] uses to find chunk boundaries.
+type Hasher int
+
+const (
+	// HasherBuzhash is the default: a buzhash-based rolling checksum.
+	HasherBuzhash Hasher = iota
+
+	// HasherFastCDC selects FastCDC's gear hash with normalized chunking
+	// instead. It's faster than HasherBuzhash, because the gear hash mixes
+	// in each byte without maintaining a sliding window, but that also means
+	// a Splitter using it cannot be checkpointed with [Splitter.Checkpoint].
+	// It always enforces a maximum chunk size: [Splitter.MaxSize] if positive,
+	// otherwise 8 times the average chunk size (2^SplitBits).
+	HasherFastCDC
+)
+
+func (h Hasher) String() string {
+	switch h {
+	case HasherBuzhash:
+		return "buzhash"
+	case HasherFastCDC:
+		return "fastcdc"
+	default:
+		return fmt.Sprintf("Hasher(%d)", int(h))
+	}
+}
+
+// splitFastCDC is [Splitter.Split]'s implementation when s.Hasher is HasherFastCDC.
+func (s *Splitter) splitFastCDC(ctx context.Context, r io.Reader) (iter.Seq2[[]byte, int], *error) {
+	var br io.ByteReader
+	if b, ok := r.(io.ByteReader); ok {
+		br = b
+	} else {
+		br = bufio.NewReader(r)
+	}
+
+	minSize := s.MinSize
+	if minSize <= 0 {
+		minSize = defaultMinSize
+	}
+	splitBits := s.SplitBits
+	if splitBits == 0 {
+		splitBits = defaultSplitBits
+	}
+	avgSize := 1 << splitBits
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = avgSize * 8
+	}
+
+	fc := newFastCDC(minSize, avgSize, maxSize, splitBits)
+
+	var err error
+
+	f := func(yield func([]byte, int) bool) {
+		for {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return
+			}
+			var c byte
+			c, err = br.ReadByte()
+			if errors.Is(err, io.EOF) {
+				err = nil
+				if len(s.chunk) > 0 {
+					yield(s.chunk, fastCDCLevel(fc.h, splitBits))
+				}
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			s.chunk = append(s.chunk, c)
+			s.consumed++
+
+			if fc.roll(c) {
+				// A cut forced by maxSize has level 0, as with HasherBuzhash.
+				level := 0
+				if len(s.chunk) < maxSize {
+					level = fastCDCLevel(fc.h, splitBits)
+				}
+				chunk := s.chunk
+				s.chunk = nil
+				fc.reset()
+				if !yield(chunk, level) {
+					return
+				}
+			}
+		}
+	}
+
+	return f, &err
+}
+
+// fastCDCLevel derives a hashsplit tree "level" from a gear hash the same way
+// checkSplit does for the buzhash rolling checksum, so FastCDC-split chunks
+// can still be fed to [Tree]: it's the number of trailing zero bits in h in
+// excess of splitBits.
+func fastCDCLevel(h uint64, splitBits int) int {
+	tz := bits.TrailingZeros64(h)
+	if tz < splitBits {
+		return 0
+	}
+	return tz - splitBits
+}
+
+// gearTable holds 256 pseudo-random 64-bit values, one per input byte,
+// used by FastCDC's gear hash.
+//
+// Unlike the buzhash/rolling-checksum approach Splitter uses by default,
+// the gear hash mixes in the incoming byte on every step without reference
+// to a sliding window, so there's no "priming" step and no per-byte window
+// bookkeeping -- just a shift and an add. That makes it considerably faster,
+// at the cost of the hash no longer being a true rolling checksum
+// (it has no way to "forget" a byte that falls out of a window,
+// because there is no window).
+var gearTable = generateGearTable(1)
+
+// generateGearTable deterministically derives 256 64-bit values from seed,
+// using the same splitmix64-style generator for every Splitter
+// so that FastCDC chunk boundaries are reproducible across processes.
+func generateGearTable(seed uint64) [256]uint64 {
+	var table [256]uint64
+	x := seed
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z = z ^ (z >> 31)
+		table[i] = z
+	}
+	return table
+}
+
+// fastCDC implements FastCDC's gear hash with normalized chunking
+// (see https://ieeexplore.ieee.org/document/8416116).
+//
+// Below minSize no split is possible.
+// Between minSize and the target average chunk size,
+// a split requires maskS (a stricter mask, with more required zero bits)
+// to be satisfied, which narrows the chunk-size distribution
+// by making the smaller end of the range less likely.
+// From the target average up to maxSize,
+// a split only requires the looser maskL,
+// making the larger end of the range more likely to end a chunk before
+// maxSize forces a cut.
+type fastCDC struct {
+	h uint64
+
+	minSize, avgSize, maxSize int
+	maskS, maskL              uint64
+
+	n int // bytes seen since the last cut
+}
+
+// newFastCDC returns a fastCDC configured for the given minimum, average,
+// and maximum chunk sizes, with normalized-chunking masks derived from
+// splitBits -- the number of trailing zero bits an unnormalized hash would
+// need, on average, to produce avgSize-sized chunks.
+func newFastCDC(minSize, avgSize, maxSize, splitBits int) *fastCDC {
+	// maskS has two more required zero bits than splitBits (stricter: harder
+	// to satisfy, so fewer, larger chunks below the average), and maskL has
+	// two fewer (looser: easier to satisfy, so more, smaller chunks above it).
+	// This is the "normalization level" of 2 that the FastCDC paper found
+	// tightens the chunk-size distribution well in practice.
+	const normalization = 2
+
+	maskBits := splitBits + normalization
+	if maskBits > 63 {
+		maskBits = 63
+	}
+	maskS := uint64(1)<<maskBits - 1
+
+	maskBits = splitBits - normalization
+	if maskBits < 1 {
+		maskBits = 1
+	}
+	maskL := uint64(1)<<maskBits - 1
+
+	return &fastCDC{
+		minSize: minSize,
+		avgSize: avgSize,
+		maxSize: maxSize,
+		maskS:   maskS,
+		maskL:   maskL,
+	}
+}
+
+// roll mixes in the next byte and reports whether it completes a chunk.
+func (f *fastCDC) roll(c byte) bool {
+	f.h = (f.h << 1) + gearTable[c]
+	f.n++
+
+	switch {
+	case f.n < f.minSize:
+		return false
+	case f.n >= f.maxSize:
+		return true
+	case f.n < f.avgSize:
+		return f.h&f.maskS == 0
+	default:
+		return f.h&f.maskL == 0
+	}
+}
+
+// reset prepares f to start accumulating a new chunk.
+func (f *fastCDC) reset() {
+	f.h = 0
+	f.n = 0
+}
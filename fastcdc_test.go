@@ -0,0 +1,64 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestFastCDCRoundTrip(t *testing.T) {
+	text := genText()
+
+	s := &Splitter{Hasher: HasherFastCDC, SplitBits: 10}
+	split, errptr := s.Split(context.Background(), bytes.NewReader(text))
+
+	var got bytes.Buffer
+	var maxChunk int
+	for chunk, level := range split {
+		if level != 0 {
+			t.Fatalf("got chunk level %d, want 0 for FastCDC chunks", level)
+		}
+		if len(chunk) > maxChunk {
+			maxChunk = len(chunk)
+		}
+		got.Write(chunk)
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), text) {
+		t.Fatal("reconstructed content does not match original")
+	}
+	if maxChunk > s.MaxSize && s.MaxSize > 0 {
+		t.Fatalf("saw a chunk of size %d, want <= MaxSize %d", maxChunk, s.MaxSize)
+	}
+}
+
+func TestFastCDCMaxSize(t *testing.T) {
+	text := bytes.Repeat([]byte{0}, 10000)
+
+	s := &Splitter{Hasher: HasherFastCDC, MaxSize: 500}
+	split, errptr := s.Split(context.Background(), bytes.NewReader(text))
+
+	var got bytes.Buffer
+	for chunk := range split {
+		if len(chunk) > s.MaxSize {
+			t.Fatalf("got chunk of size %d, want <= MaxSize %d", len(chunk), s.MaxSize)
+		}
+		got.Write(chunk)
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), text) {
+		t.Fatal("reconstructed content does not match original")
+	}
+}
+
+func TestFastCDCCheckpointUnsupported(t *testing.T) {
+	s := &Splitter{Hasher: HasherFastCDC}
+	if _, err := s.Checkpoint(); err == nil {
+		t.Fatal("expected an error checkpointing a FastCDC Splitter")
+	}
+}
@@ -3,10 +3,12 @@ package hashsplit
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"io"
 	"iter"
 	"math/bits"
+	"sort"
 
 	"github.com/chmduquesne/rollinghash/buzhash32"
 )
@@ -60,6 +62,25 @@ type Splitter struct {
 	// That makes the median chunk size 5,678 when SplitBits==13.)
 	SplitBits int
 
+	// MaxSize, if positive, forces a chunk boundary once a chunk reaches this
+	// many bytes, even if the rolling hash never would have put one there.
+	// A forced cut always has level 0.
+	// If you leave this set to zero, there is no maximum
+	// (except when Hasher is [HasherFastCDC], which then uses 8 times the
+	// average chunk size, 2^SplitBits).
+	MaxSize int
+
+	// Hasher selects the algorithm Split uses to find chunk boundaries.
+	// The default (HasherBuzhash, the zero value) is the rolling checksum
+	// described above. See [HasherFastCDC] for the alternative.
+	Hasher Hasher
+
+	// Workers is the number of goroutines [Splitter.SplitAndHash] uses
+	// to compute chunk hashes in parallel.
+	// If you leave this set to zero, 1 is what you'll get
+	// (i.e., a single goroutine does all the hashing, unparallelized).
+	Workers int
+
 	// The chunk being built.
 	chunk []byte
 
@@ -67,13 +88,22 @@ type Splitter struct {
 	// according to the document at github.com/hashsplit/hashsplit-spec
 	// (presently in draft form).
 	rs *buzhash32.Buzhash32
+
+	// window, widx, and consumed mirror state already held inside rs
+	// (which doesn't expose it) so that [Splitter.Checkpoint] can snapshot it:
+	// window is rs's rolling-checksum window as a ring buffer,
+	// widx is the index of its oldest byte (i.e. where the next one will land),
+	// and consumed is the total number of bytes Split has read so far.
+	window   [windowSize]byte
+	widx     int
+	consumed uint64
 }
 
 // Split hashsplits its input using a default Splitter.
 // See [Splitter.Split].
-func Split(r io.Reader) (iter.Seq2[[]byte, int], *error) {
+func Split(ctx context.Context, r io.Reader) (iter.Seq2[[]byte, int], *error) {
 	s := NewSplitter()
-	return s.Split(r)
+	return s.Split(ctx, r)
 }
 
 // NewSplitter produces a new Splitter.
@@ -97,12 +127,20 @@ func NewSplitter() *Splitter {
 // You can think of this as a measure of how badly the Splitter wanted to put a chunk boundary here.
 // This number is used in constructing a hashsplit tree; see [Tree].
 //
+// Split honors ctx: if it's canceled before the stream is exhausted,
+// Split stops reading promptly, abandoning the in-progress chunk, and the
+// returned error is ctx.Err().
+//
 // After consuming the returned iterator,
 // the caller should dereference the returned error pointer
 // to see if any call to the underlying reader produced an error.
 //
 // The Splitter should not be reused for another stream after this call.
-func (s *Splitter) Split(r io.Reader) (iter.Seq2[[]byte, int], *error) {
+func (s *Splitter) Split(ctx context.Context, r io.Reader) (iter.Seq2[[]byte, int], *error) {
+	if s.Hasher == HasherFastCDC {
+		return s.splitFastCDC(ctx, r)
+	}
+
 	var br io.ByteReader
 	if b, ok := r.(io.ByteReader); ok {
 		br = b
@@ -119,6 +157,10 @@ func (s *Splitter) Split(r io.Reader) (iter.Seq2[[]byte, int], *error) {
 
 	f := func(yield func([]byte, int) bool) {
 		for {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return
+			}
 			var c byte
 			c, err = br.ReadByte()
 			if errors.Is(err, io.EOF) {
@@ -134,14 +176,30 @@ func (s *Splitter) Split(r io.Reader) (iter.Seq2[[]byte, int], *error) {
 			}
 			s.chunk = append(s.chunk, c)
 			s.rs.Roll(c)
+			s.window[s.widx] = c
+			s.widx = (s.widx + 1) % windowSize
+			s.consumed++
 			if len(s.chunk) < minSize {
 				continue
 			}
-			if level, shouldSplit := s.checkSplit(); shouldSplit {
-				if !yield(s.chunk, level) {
+			if s.MaxSize > 0 && len(s.chunk) >= s.MaxSize {
+				chunk := s.chunk
+				s.chunk = nil
+				if !yield(chunk, 0) {
 					return
 				}
+				continue
+			}
+			if level, shouldSplit := s.checkSplit(); shouldSplit {
+				// Reset s.chunk before yielding (rather than after)
+				// so that a [Splitter.Checkpoint] taken from inside yield
+				// sees an empty in-progress chunk buffer,
+				// matching the fact that the chunk being yielded is already closed.
+				chunk := s.chunk
 				s.chunk = nil
+				if !yield(chunk, level) {
+					return
+				}
 			}
 		}
 	}
@@ -190,6 +248,10 @@ func (s *Splitter) checkSplit() (int, bool) {
 // up to and including a chunk at level L>N;
 // then a new level-N node begins.
 //
+// Tree honors ctx: if it's canceled before inp is exhausted,
+// Tree stops consuming inp and yielding promptly, abandoning the
+// partially built tree, and the returned error is ctx.Err().
+//
 // # ITERATOR DETAILS
 //
 // Each time Tree consumes a chunk at level L>0,
@@ -222,8 +284,8 @@ func (s *Splitter) checkSplit() (int, bool) {
 // like a hash or a lookup key.
 // Here's how this might be done:
 //
-//	split, errptr := hashsplit.Split(input)
-//	tree := hashsplit.Tree(split)
+//	split, errptr := hashsplit.Split(ctx, input)
+//	tree, treeErrptr := hashsplit.Tree(ctx, split)
 //	var root *hashsplit.TreeNode
 //	for node := range tree {
 //	  for i, chunk := range node.Chunks {
@@ -238,6 +300,9 @@ func (s *Splitter) checkSplit() (int, bool) {
 //	if err := *errptr; err != nil {
 //	  panic(err)
 //	}
+//	if err := *treeErrptr; err != nil {
+//	  panic(err)
+//	}
 //
 // After this, root is the root of the tree,
 // and the leaves no longer have the original input chunks,
@@ -252,9 +317,9 @@ func (s *Splitter) checkSplit() (int, bool) {
 // you have to narrow the range of chunk levels seen by Tree.
 // Here's how that might look:
 //
-//	split, errptr := hashsplit.Split(input)
+//	split, errptr := hashsplit.Split(ctx, input)
 //	reducedLevels := seqs.Map2(split, func(chunk []byte, level int) ([]byte, int) { return chunk, level/4 })
-//	tree := hashsplit.Tree(reducedLevels)
+//	tree, treeErrptr := hashsplit.Tree(ctx, reducedLevels)
 //	var root *hashsplit.TreeNode
 //	for node := range tree {
 //	  root = node
@@ -262,54 +327,13 @@ func (s *Splitter) checkSplit() (int, bool) {
 //	if err := *errptr; err != nil {
 //	  panic(err)
 //	}
+//	if err := *treeErrptr; err != nil {
+//	  panic(err)
+//	}
 //
 // (See https://pkg.go.dev/github.com/bobg/seqs#Map2 for an explanation of the Map2 function used here.)
-func Tree(inp iter.Seq2[[]byte, int]) iter.Seq2[*TreeNode, int] {
-	return func(yield func(*TreeNode, int) bool) {
-		levels := []*TreeNode{{}} // One empty level-0 node.
-		for chunk, level := range inp {
-			levels[0].Chunks = append(levels[0].Chunks, chunk)
-			for _, n := range levels {
-				n.Size += uint64(len(chunk))
-			}
-			for i := 0; i < level; i++ {
-				if i == len(levels)-1 {
-					levels = append(levels, &TreeNode{
-						Size: levels[i].Size,
-					})
-				}
-
-				n := levels[i]
-				levels[i+1].Children = append(levels[i+1].Children, n)
-
-				if !yield(n, i) {
-					return
-				}
-
-				levels[i] = &TreeNode{
-					Offset: levels[i+1].Offset + levels[i+1].Size,
-				}
-			}
-		}
-
-		if len(levels[0].Chunks) == 0 {
-			return
-		}
-
-		for i := 0; i < len(levels)-1; i++ {
-			levels[i+1].Children = append(levels[i+1].Children, levels[i])
-		}
-
-		top := len(levels) - 1
-		for top > 0 && len(levels[top].Children) == 1 {
-			top--
-		}
-		for i := 0; i <= top; i++ {
-			if !yield(levels[i], i) {
-				return
-			}
-		}
-	}
+func Tree(ctx context.Context, inp iter.Seq2[[]byte, int]) (iter.Seq2[*TreeNode, int], *error) {
+	return NewTreeBuilder().Tree(ctx, inp)
 }
 
 // Root takes the output of [Tree] and returns the root of the tree.
@@ -356,6 +380,50 @@ func (n *TreeNode) AllChunks() iter.Seq[[]byte] {
 	}
 }
 
+// Pre returns an iterator over n and all its descendants, in preorder
+// (a node before any of its children), the same order [TreeNode.MarshalBinary]
+// encodes them in.
+func (n *TreeNode) Pre() iter.Seq[*TreeNode] {
+	return func(yield func(*TreeNode) bool) {
+		var walk func(*TreeNode) bool
+		walk = func(n *TreeNode) bool {
+			if !yield(n) {
+				return false
+			}
+			for _, child := range n.Children {
+				if !walk(child) {
+					return false
+				}
+			}
+			return true
+		}
+		walk(n)
+	}
+}
+
+// Walk is a callback-based alternative to [TreeNode.Pre]:
+// it calls fn(n) and then, in order, fn on each of n's descendants,
+// preorder, stopping at the first error fn returns (which Walk then returns
+// to its own caller) or the first time ctx is canceled (in which case Walk
+// returns ctx.Err()).
+//
+// Prefer Walk over Pre when a per-node error needs to abort the walk;
+// Pre's push-based iterator has no way to report one.
+func (n *TreeNode) Walk(ctx context.Context, fn func(*TreeNode) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := fn(n); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.Walk(ctx, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ErrNotFound is the error returned by Seek when the seek position lies outside the given node's range.
 var ErrNotFound = errors.New("not found")
 
@@ -366,20 +434,17 @@ func Seek(n *TreeNode, pos uint64) (*TreeNode, error) {
 		return nil, ErrNotFound
 	}
 
-	num := len(n.Children)
-	if num == 0 {
+	if len(n.Children) == 0 {
 		return n, nil
 	}
 
-	// TODO: if a Node kept track of its children's offsets,
-	// this loop could be replaced with a sort.Search call.
-	for _, child := range n.Children {
-		if pos >= (child.Offset + child.Size) {
-			continue
-		}
-		return Seek(child, pos)
+	i := sort.Search(len(n.Children), func(i int) bool {
+		c := n.Children[i]
+		return pos < c.Offset+c.Size
+	})
+	if i == len(n.Children) {
+		// With a properly formed tree of nodes this will not be reached.
+		return nil, ErrNotFound
 	}
-
-	// With a properly formed tree of nodes this will not be reached.
-	return nil, ErrNotFound
+	return Seek(n.Children[i], pos)
 }
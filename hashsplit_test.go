@@ -2,8 +2,11 @@ package hashsplit
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -15,6 +18,8 @@ import (
 )
 
 func TestSplitAndTree(t *testing.T) {
+	ctx := context.Background()
+
 	files, err := os.ReadDir("testdata")
 	if err != nil {
 		t.Fatal(err)
@@ -47,7 +52,7 @@ func TestSplitAndTree(t *testing.T) {
 						s.MinSize = minSize
 						s.MaxSize = maxSize
 
-						split, errptr := s.Split(bytes.NewReader(text))
+						split, errptr := s.Split(ctx, bytes.NewReader(text))
 						pairs := slices.Collect(seqs.ToPairs(split))
 						if err := *errptr; err != nil {
 							t.Fatal(err)
@@ -79,8 +84,11 @@ func TestSplitAndTree(t *testing.T) {
 						})
 
 						t.Run("tree", func(t *testing.T) {
-							tree := Tree(seqs.FromPairs(slices.Values(pairs)))
+							tree, treeErrptr := Tree(ctx, seqs.FromPairs(slices.Values(pairs)))
 							root, ok := seqs.Last(seqs.Left(tree))
+							if err := *treeErrptr; err != nil {
+								t.Fatal(err)
+							}
 							if len(pairs) == 0 {
 								if ok {
 									t.Fatal("non-empty tree")
@@ -115,6 +123,130 @@ func TestSplitAndTree(t *testing.T) {
 	}
 }
 
+// TestSplitCancellation checks that Split stops as soon as it notices ctx
+// canceled, rather than running the input to completion regardless.
+func TestSplitCancellation(t *testing.T) {
+	text := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(text)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	split, errptr := Split(ctx, bytes.NewReader(text))
+
+	var n int
+	for range split {
+		n++
+		cancel()
+	}
+	if n != 1 {
+		t.Fatalf("got %d chunks before canceling, want 1", n)
+	}
+	if err := *errptr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+}
+
+// TestTreeCancellation is TestSplitCancellation's counterpart for Tree:
+// it checks that Tree stops consuming its input and yielding as soon as
+// it notices ctx canceled.
+func TestTreeCancellation(t *testing.T) {
+	inp := func(yield func([]byte, int) bool) {
+		for i := 0; i < 1000; i++ {
+			if !yield([]byte{byte(i)}, 1) {
+				return
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tree, errptr := Tree(ctx, inp)
+
+	var n int
+	for range tree {
+		n++
+		cancel()
+	}
+	if n != 1 {
+		t.Fatalf("got %d nodes before canceling, want 1", n)
+	}
+	if err := *errptr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	// Random (rather than repetitive) content, so the tree has more than
+	// one node and Walk's recursion into Children is actually exercised.
+	text := make([]byte, 300000)
+	rand.New(rand.NewSource(2)).Read(text)
+
+	root, err := buildTree(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("full traversal", func(t *testing.T) {
+		var want []*TreeNode
+		for node := range root.Pre() {
+			want = append(want, node)
+		}
+
+		var got []*TreeNode
+		err := root.Walk(context.Background(), func(n *TreeNode) error {
+			got = append(got, n)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("Walk visited %d nodes, Pre visited %d", len(got), len(want))
+		}
+		for i, n := range want {
+			if got[i] != n {
+				t.Fatalf("node %d: Walk and Pre disagree on traversal order", i)
+			}
+		}
+	})
+
+	t.Run("early abort", func(t *testing.T) {
+		wantErr := errors.New("stop here")
+
+		var n int
+		err := root.Walk(context.Background(), func(*TreeNode) error {
+			n++
+			if n == 2 {
+				return wantErr
+			}
+			return nil
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("got err %v, want %v", err, wantErr)
+		}
+		if n != 2 {
+			t.Fatalf("fn was called %d times, want 2", n)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var called bool
+		err := root.Walk(ctx, func(*TreeNode) error {
+			called = true
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got err %v, want context.Canceled", err)
+		}
+		if called {
+			t.Fatal("fn was called with an already-canceled context")
+		}
+	})
+}
+
 func TestSeek(t *testing.T) {
 	text, err := os.ReadFile("testdata/commonsense")
 	if err != nil {
@@ -152,7 +284,7 @@ func TestSeek(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			got, err := root.Seek(c.pos)
+			got, err := Seek(root, c.pos)
 			if c.wanterr {
 				if err == nil {
 					t.Error("wanted an error, got nil")
@@ -182,7 +314,7 @@ func BenchmarkSeek(b *testing.B) {
 
 	b.ResetTimer()
 	for range b.N {
-		_, _ = root.Seek(100000)
+		_, _ = Seek(root, 100000)
 	}
 }
 
@@ -200,12 +332,16 @@ func BenchmarkTree(b *testing.B) {
 }
 
 func buildTree(text []byte) (*TreeNode, error) {
-	split, errptr := Split(bytes.NewReader(text))
-	tree := Tree(split)
+	ctx := context.Background()
+	split, errptr := Split(ctx, bytes.NewReader(text))
+	tree, treeErrptr := Tree(ctx, split)
 	var root *TreeNode
 	for node := range tree {
 		root = node
 	}
+	if err := *treeErrptr; err != nil {
+		return nil, err
+	}
 	return root, *errptr
 }
 
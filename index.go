@@ -0,0 +1,380 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"sort"
+)
+
+// indexBranchFactor caps the number of entries stored in any single
+// on-disk index node (see indexNode), so that fetching one node from the
+// store -- whether a leaf or an interior node -- is always a small,
+// bounded-size read regardless of how many leaves the indexed tree has.
+const indexBranchFactor = 64
+
+// IndexEntry records the Ref of a node reachable through an [Index] and
+// the range of the original input stream it covers: either a leaf
+// [RefNode] (in a leaf indexNode) or a child indexNode (in an interior
+// one).
+type IndexEntry struct {
+	Offset, Size uint64
+	Ref          Ref
+}
+
+// indexNode is one node of the on-disk B+tree built by [BuildIndex]: a
+// sorted, gapless run of up to indexBranchFactor IndexEntry values. In a
+// leaf node, each entry's Ref points at a leaf [RefNode] of the indexed
+// tree; in an interior node, each entry's Ref points at a child
+// indexNode, and Size is the total size covered by that whole subtree
+// (not just the child node's own entries). Offset disambiguates entries
+// that would otherwise share a boundary, the same role a key plays in an
+// ordinary B+tree.
+type indexNode struct {
+	leaf    bool
+	entries []IndexEntry
+}
+
+// Index is a handle to a B+tree, persisted entirely in a [BlobStore],
+// that indexes the leaf nodes of a content-addressed tree (see
+// [BuildRefTree]). Unlike [RefSeek], which descends the indexed tree
+// itself one level -- and one store fetch -- at a time, [Index.Seek]
+// descends this separate, much shallower tree instead, so it costs
+// O(log n) store fetches and never needs more than one indexNode (at
+// most indexBranchFactor entries) in memory at a time, regardless of how
+// large the indexed tree is or how it's shaped.
+//
+// Build an Index once, with [BuildIndex] -- which persists every node it
+// creates as it creates them -- and keep just its Root ref alongside the
+// tree's own root ref; [StoreIndex] and [LoadIndex] help with that.
+type Index struct {
+	// Root is the ref of this index's top-level indexNode.
+	Root Ref
+}
+
+// BuildIndex walks the tree stored under root, once, grouping its leaf
+// nodes into indexBranchFactor-sized indexNodes and those, in turn, into
+// further levels of indexNodes, bottom-up, until a single root node
+// remains; every node is stored as it's completed. It fetches each node
+// of the indexed tree exactly once, the same cost as a full traversal
+// with [RefAllChunks] or [RefPre], and never holds more than one
+// in-progress node per level in memory at a time.
+func BuildIndex(ctx context.Context, store BlobStore, root Ref) (*Index, error) {
+	b := newIndexLevelBuilder(ctx, store, true)
+
+	var walk func(Ref) error
+	walk = func(ref Ref) error {
+		node, err := fetchRefNode(ctx, store, ref)
+		if err != nil {
+			return err
+		}
+		if len(node.ChildRefs) == 0 {
+			return b.add(IndexEntry{Offset: node.Offset, Size: node.Size, Ref: ref})
+		}
+		for _, child := range node.ChildRefs {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+
+	rootRef, err := b.finish()
+	if err != nil {
+		return nil, err
+	}
+	return &Index{Root: rootRef}, nil
+}
+
+// indexLevelBuilder accumulates the entries for one level of the B+tree
+// built by [BuildIndex], flushing a node to store -- and producing one
+// separator entry for the level above -- every indexBranchFactor
+// entries. A level that turns out to need only a single node becomes the
+// tree's root directly, without an unnecessary level wrapping it.
+type indexLevelBuilder struct {
+	ctx     context.Context
+	store   BlobStore
+	leaf    bool
+	pending []IndexEntry
+
+	// firstSep holds the separator for this level's first stored node
+	// until a second one proves this level needs a parent; see flush.
+	firstSep     IndexEntry
+	haveFirstSep bool
+
+	parent *indexLevelBuilder
+}
+
+func newIndexLevelBuilder(ctx context.Context, store BlobStore, leaf bool) *indexLevelBuilder {
+	return &indexLevelBuilder{ctx: ctx, store: store, leaf: leaf}
+}
+
+// add appends e to the level, flushing a node to store once
+// indexBranchFactor entries have accumulated.
+func (b *indexLevelBuilder) add(e IndexEntry) error {
+	b.pending = append(b.pending, e)
+	if len(b.pending) == indexBranchFactor {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush stores the pending entries as a node, if there are any, and
+// either remembers its separator (if this is the level's first node) or
+// forwards it -- along with the first node's separator, the first time
+// this happens -- to a parent level.
+func (b *indexLevelBuilder) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	sep, err := b.store1(b.pending)
+	if err != nil {
+		return err
+	}
+	b.pending = nil
+
+	if !b.haveFirstSep {
+		b.firstSep, b.haveFirstSep = sep, true
+		return nil
+	}
+	if b.parent == nil {
+		b.parent = newIndexLevelBuilder(b.ctx, b.store, false)
+		if err := b.parent.add(b.firstSep); err != nil {
+			return err
+		}
+	}
+	return b.parent.add(sep)
+}
+
+// store1 serializes and stores a single node built from entries, and
+// returns the separator that refers to it in the level above.
+func (b *indexLevelBuilder) store1(entries []IndexEntry) (IndexEntry, error) {
+	node := indexNode{leaf: b.leaf, entries: entries}
+	data, err := node.MarshalBinary()
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	ref, err := b.store.Put(b.ctx, data)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("hashsplit: storing index node: %w", err)
+	}
+
+	sep := IndexEntry{Offset: entries[0].Offset, Ref: ref}
+	for _, e := range entries {
+		sep.Size += e.Size
+	}
+	return sep, nil
+}
+
+// finish flushes this level's final, possibly partial, node and returns
+// the ref of the tree's overall root: this level's only node, if it
+// never needed a parent, or whatever finishing the parent level produces.
+func (b *indexLevelBuilder) finish() (Ref, error) {
+	if err := b.flush(); err != nil {
+		return nil, err
+	}
+	if b.parent != nil {
+		return b.parent.finish()
+	}
+	if !b.haveFirstSep {
+		return nil, fmt.Errorf("hashsplit: cannot build an index with no entries")
+	}
+	return b.firstSep.Ref, nil
+}
+
+// descendToLeaf walks from idx.Root to the leaf indexNode covering pos,
+// fetching one node per level and never holding more than one in memory
+// at a time. It returns the leaf node and the index within it of the
+// entry covering pos, or a nil node if pos lies outside every entry.
+func (idx *Index) descendToLeaf(ctx context.Context, store BlobStore, pos uint64) (*indexNode, int, error) {
+	ref := idx.Root
+	for {
+		node, err := fetchIndexNode(ctx, store, ref)
+		if err != nil {
+			return nil, 0, err
+		}
+		i := sort.Search(len(node.entries), func(i int) bool {
+			e := node.entries[i]
+			return pos < e.Offset+e.Size
+		})
+		if i == len(node.entries) || pos < node.entries[i].Offset {
+			return nil, 0, nil
+		}
+		if node.leaf {
+			return node, i, nil
+		}
+		ref = node.entries[i].Ref
+	}
+}
+
+// Seek locates the leaf [RefNode] covering pos in O(log n) store fetches,
+// one per level of the index, without ever fetching an interior node of
+// the indexed tree itself (contrast [RefSeek], which does both).
+func (idx *Index) Seek(ctx context.Context, store BlobStore, pos uint64) (*RefNode, error) {
+	node, i, err := idx.descendToLeaf(ctx, store, pos)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, ErrNotFound
+	}
+	return fetchRefNode(ctx, store, node.entries[i].Ref)
+}
+
+// Range returns an iterator over the leaf nodes whose ranges overlap
+// [lo, hi), in offset order, descending the index once per leaf
+// indexNode of entries it streams through.
+//
+// After consuming the returned iterator, the caller should dereference
+// the returned error pointer to see whether a fetch from store failed.
+func (idx *Index) Range(ctx context.Context, store BlobStore, lo, hi uint64) (iter.Seq[*RefNode], *error) {
+	var err error
+
+	f := func(yield func(*RefNode) bool) {
+		pos := lo
+		for pos < hi {
+			node, i, e := idx.descendToLeaf(ctx, store, pos)
+			if e != nil {
+				err = e
+				return
+			}
+			if node == nil {
+				return
+			}
+			for ; i < len(node.entries) && node.entries[i].Offset < hi; i++ {
+				leaf, e := fetchRefNode(ctx, store, node.entries[i].Ref)
+				if e != nil {
+					err = e
+					return
+				}
+				if !yield(leaf) {
+					return
+				}
+				pos = node.entries[i].Offset + node.entries[i].Size
+			}
+			if i < len(node.entries) {
+				return
+			}
+			// Exhausted this leaf node's entries before reaching hi:
+			// pos now sits just past it, so loop around and descend
+			// again for the node that follows.
+		}
+	}
+
+	return f, &err
+}
+
+// indexNodeFormatVersion is the version byte written by
+// [indexNode.MarshalBinary] and checked by UnmarshalBinary. It's
+// independent of [treeFormatVersion] and [refNodeFormatVersion]: all
+// three are different wire formats.
+const indexNodeFormatVersion = 1
+
+// MarshalBinary encodes n in a format suitable for storage in a
+// [BlobStore] and later decoding with UnmarshalBinary.
+func (n *indexNode) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(indexNodeFormatVersion)
+	if n.leaf {
+		buf.WriteByte(nodeKindLeaf)
+	} else {
+		buf.WriteByte(nodeKindInterior)
+	}
+	putUvarint(&buf, uint64(len(n.entries)))
+	for _, e := range n.entries {
+		putUint64(&buf, e.Offset)
+		putUint64(&buf, e.Size)
+		putUvarint(&buf, uint64(len(e.Ref)))
+		buf.Write(e.Ref)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes an indexNode previously encoded with
+// MarshalBinary, replacing n's contents with the decoded node's.
+func (n *indexNode) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading format version: %w", err)
+	}
+	if version != indexNodeFormatVersion {
+		return fmt.Errorf("hashsplit: unsupported index node format version %d", version)
+	}
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading node kind: %w", err)
+	}
+	leaf := kind == nodeKindLeaf
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading entry count: %w", err)
+	}
+
+	entries := make([]IndexEntry, count)
+	for i := range entries {
+		offset, err := getUint64(r)
+		if err != nil {
+			return fmt.Errorf("hashsplit: reading entry %d offset: %w", i, err)
+		}
+		size, err := getUint64(r)
+		if err != nil {
+			return fmt.Errorf("hashsplit: reading entry %d size: %w", i, err)
+		}
+		ref, err := readChunk(r, 0)
+		if err != nil {
+			return fmt.Errorf("hashsplit: reading entry %d ref: %w", i, err)
+		}
+		entries[i] = IndexEntry{Offset: offset, Size: size, Ref: Ref(ref)}
+	}
+
+	if r.Len() != 0 {
+		return fmt.Errorf("hashsplit: %d trailing bytes after index node", r.Len())
+	}
+
+	n.leaf = leaf
+	n.entries = entries
+	return nil
+}
+
+// fetchIndexNode retrieves and decodes the index node stored under ref.
+func fetchIndexNode(ctx context.Context, store BlobStore, ref Ref) (*indexNode, error) {
+	data, err := store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: fetching index node %x: %w", []byte(ref), err)
+	}
+	var n indexNode
+	if err := n.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("hashsplit: decoding index node %x: %w", []byte(ref), err)
+	}
+	return &n, nil
+}
+
+// StoreIndex persists idx -- just its Root ref, since [BuildIndex] has
+// already stored every node of the tree it describes -- in store, and
+// returns its own Ref for later retrieval with [LoadIndex].
+func StoreIndex(ctx context.Context, store BlobStore, idx *Index) (Ref, error) {
+	ref, err := store.Put(ctx, idx.Root)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: storing index: %w", err)
+	}
+	return ref, nil
+}
+
+// LoadIndex retrieves the index root ref previously stored under ref
+// with [StoreIndex].
+func LoadIndex(ctx context.Context, store BlobStore, ref Ref) (*Index, error) {
+	data, err := store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: fetching index %x: %w", []byte(ref), err)
+	}
+	return &Index{Root: Ref(data)}, nil
+}
@@ -0,0 +1,181 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestIndexSeekAndRange(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	store := make(MapStore)
+	root, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := BuildIndex(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Root) == 0 {
+		t.Fatal("BuildIndex produced an empty root ref")
+	}
+
+	rootNode, err := fetchRefNode(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pos := range []uint64{0, 1000, rootNode.Size / 2, rootNode.Size - 1} {
+		node, err := idx.Seek(ctx, store, pos)
+		if err != nil {
+			t.Fatalf("seeking to %d: %v", pos, err)
+		}
+		if len(node.ChildRefs) != 0 {
+			t.Fatalf("Seek(%d) did not return a leaf node", pos)
+		}
+		if pos < node.Offset || pos >= node.Offset+node.Size {
+			t.Fatalf("Seek(%d) returned a node covering [%d, %d)", pos, node.Offset, node.Offset+node.Size)
+		}
+	}
+
+	if _, err := idx.Seek(ctx, store, rootNode.Size); err != ErrNotFound {
+		t.Fatalf("got err %v seeking past the end, want ErrNotFound", err)
+	}
+
+	lo, hi := rootNode.Size/4, rootNode.Size*3/4
+	var covered uint64
+	var prevEnd uint64
+	nodes, errptr := idx.Range(ctx, store, lo, hi)
+	for node := range nodes {
+		if covered == 0 {
+			if node.Offset+node.Size <= lo {
+				t.Fatalf("first node [%d, %d) does not overlap [%d, %d)", node.Offset, node.Offset+node.Size, lo, hi)
+			}
+		} else if node.Offset != prevEnd {
+			t.Fatalf("gap in Range output: previous node ended at %d, next starts at %d", prevEnd, node.Offset)
+		}
+		prevEnd = node.Offset + node.Size
+		covered++
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if covered == 0 {
+		t.Fatal("Range produced no nodes")
+	}
+}
+
+// TestIndexMultiLevel builds an index over a tree with enough leaves to
+// force BuildIndex past a single indexBranchFactor-sized node, so Seek
+// and Range have to descend through an interior level of the index
+// itself, not just the indexed tree.
+func TestIndexMultiLevel(t *testing.T) {
+	ctx := context.Background()
+	text := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(text)
+
+	store := make(MapStore)
+	s := NewSplitter()
+	s.SplitBits = 6 // small average chunk size, to produce many leaves
+	split, errptr := s.Split(ctx, bytes.NewReader(text))
+	tree, treeErrptr := Tree(ctx, split)
+
+	refs := make(map[*TreeNode]Ref)
+	var root Ref
+	for node := range tree {
+		rn := RefNode{Offset: node.Offset, Size: node.Size, Chunks: node.Chunks}
+		for _, child := range node.Children {
+			rn.ChildRefs = append(rn.ChildRefs, refs[child])
+		}
+		data, err := rn.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := store.Put(ctx, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[node] = ref
+		root = ref
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if err := *treeErrptr; err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := BuildIndex(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootIndexNode, err := fetchIndexNode(ctx, store, idx.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootIndexNode.leaf {
+		t.Fatal("expected a multi-level index for this many leaves, got a single leaf node")
+	}
+
+	rootNode, err := fetchRefNode(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	nodes, errptr2 := idx.Range(ctx, store, 0, rootNode.Size)
+	for node := range nodes {
+		for _, chunk := range node.Chunks {
+			got.Write(chunk)
+		}
+	}
+	if err := *errptr2; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), text) {
+		t.Fatal("ranging over the whole stream did not reconstruct it")
+	}
+}
+
+func TestIndexMarshalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	store := make(MapStore)
+	root, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := BuildIndex(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := StoreIndex(ctx, store, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadIndex(ctx, store, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Root, idx.Root) {
+		t.Fatalf("got root ref %x after round trip, want %x", []byte(got.Root), []byte(idx.Root))
+	}
+
+	node, err := got.Seek(ctx, store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.ChildRefs) != 0 {
+		t.Fatal("Seek after round trip did not return a leaf node")
+	}
+}
@@ -0,0 +1,134 @@
+package hashsplit
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"iter"
+	"sync"
+)
+
+// HashedChunk pairs a chunk produced by [Splitter.SplitAndHash]
+// with a strong content hash of its bytes.
+type HashedChunk struct {
+	Chunk []byte
+	Hash  [sha256.Size]byte
+}
+
+type hashJob struct {
+	chunk []byte
+	level int
+	seq   int
+}
+
+type hashResult struct {
+	chunk []byte
+	hash  [sha256.Size]byte
+	level int
+	seq   int
+}
+
+// SplitAndHash is like [Splitter.Split],
+// except that it additionally computes a SHA-256 hash of each chunk's content.
+//
+// The rolling checksum and the chunk-boundary decisions it drives
+// are inherently sequential,
+// so those still happen on a single goroutine exactly as in Split.
+// But once a chunk is cut, hashing its (possibly large) contents
+// is independent of every other chunk,
+// so SplitAndHash hands each chunk off to a pool of s.Workers goroutines
+// to be hashed in parallel.
+// A small reorder buffer, keyed on each chunk's position in the stream,
+// restores the original order before yielding,
+// so the result is deterministic regardless of how the workers interleave.
+//
+// SplitAndHash honors ctx exactly as [Splitter.Split] does:
+// canceling it stops the producer and worker goroutines promptly.
+//
+// The Splitter should not be reused for another stream after this call.
+func (s *Splitter) SplitAndHash(ctx context.Context, r io.Reader) (iter.Seq2[HashedChunk, int], *error) {
+	split, errptr := s.Split(ctx, r)
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	f := func(yield func(HashedChunk, int) bool) {
+		jobs := make(chan hashJob, workers)
+		results := make(chan hashResult, workers)
+		stop := make(chan struct{})
+
+		var wg sync.WaitGroup
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					results <- hashResult{
+						chunk: job.chunk,
+						hash:  sha256.Sum256(job.chunk),
+						level: job.level,
+						seq:   job.seq,
+					}
+				}
+			}()
+		}
+
+		// producerDone is closed once the goroutine below -- the only one
+		// that ranges over split, and so the only one that can be writing
+		// to *errptr when that range returns or is canceled -- has
+		// finished. The caller is free to read *errptr the moment f
+		// returns, so f must wait on producerDone before returning, even
+		// on early exit (below), or the caller's read can race with this
+		// goroutine's last write to *errptr.
+		producerDone := make(chan struct{})
+		go func() {
+			defer close(producerDone)
+			defer close(jobs)
+			seq := 0
+			for chunk, level := range split {
+				select {
+				case jobs <- hashJob{chunk: chunk, level: level, seq: seq}:
+					seq++
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		pending := make(map[int]hashResult)
+		next := 0
+		for res := range results {
+			pending[res.seq] = res
+			for {
+				res, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				if !yield(HashedChunk{Chunk: res.chunk, Hash: res.hash}, res.level) {
+					close(stop)
+					// Drain results so the producer and workers can unblock and exit.
+					go func() {
+						for range results {
+						}
+					}()
+					// Wait for the producer to stop touching *errptr before
+					// returning: the caller may read it as soon as this
+					// iterator returns.
+					<-producerDone
+					return
+				}
+			}
+		}
+	}
+
+	return f, errptr
+}
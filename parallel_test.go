@@ -0,0 +1,65 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestSplitAndHash(t *testing.T) {
+	text := genText()
+
+	s := NewSplitter()
+	s.Workers = 4
+
+	split, errptr := s.SplitAndHash(context.Background(), bytes.NewReader(text))
+
+	var got []byte
+	for hc, _ := range split {
+		if want := sha256.Sum256(hc.Chunk); want != hc.Hash {
+			t.Errorf("hash mismatch for chunk of length %d", len(hc.Chunk))
+		}
+		got = append(got, hc.Chunk...)
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, text) {
+		t.Fatalf("got %d bytes, want %d bytes; content mismatch", len(got), len(text))
+	}
+}
+
+// TestSplitAndHashCancellation checks that SplitAndHash -- like the Split
+// it wraps -- stops promptly once ctx is canceled, instead of hashing the
+// rest of the input regardless.
+func TestSplitAndHashCancellation(t *testing.T) {
+	text := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(text)
+
+	s := NewSplitter()
+	s.Workers = 4
+	s.SplitBits = 6 // small average chunk size, so there's plenty left when we cancel
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	split, errptr := s.SplitAndHash(ctx, bytes.NewReader(text))
+
+	var n int
+	for range split {
+		n++
+		cancel()
+	}
+	if n == 0 {
+		t.Fatal("produced no chunks before canceling")
+	}
+	if n > len(text)/64/8 {
+		t.Fatalf("got %d chunks after canceling on the first one, want far fewer than the ~%d the full input would produce", n, len(text)/64)
+	}
+	if err := *errptr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got err %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,143 @@
+package hashsplit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ChunkStore is the interface required by [NewReader] and [Build]
+// for storing and retrieving the leaf chunks of a hashsplit tree
+// by a caller-defined key (typically a content hash).
+type ChunkStore interface {
+	// Get returns the chunk previously stored under key.
+	Get(key []byte) ([]byte, error)
+
+	// Put stores chunk and returns the key under which Get can later retrieve it.
+	Put(chunk []byte) ([]byte, error)
+}
+
+// Build hashsplits r, stores each leaf chunk in store,
+// and returns the root of the resulting tree with each leaf's chunk
+// replaced by the key under which it was stored.
+//
+// The result is suitable for passing to [NewReader],
+// which reconstructs the original stream from store on demand.
+//
+// Build honors ctx: canceling it stops hashsplitting and tree-building
+// promptly and Build returns ctx.Err().
+func Build(ctx context.Context, r io.Reader, store ChunkStore) (*TreeNode, error) {
+	split, errptr := Split(ctx, r)
+	tree, treeErrptr := Tree(ctx, split)
+
+	var root *TreeNode
+	for node := range tree {
+		for i, chunk := range node.Chunks {
+			key, err := store.Put(chunk)
+			if err != nil {
+				return nil, fmt.Errorf("storing chunk: %w", err)
+			}
+			node.Chunks[i] = key
+		}
+		root = node
+	}
+	if err := *errptr; err != nil {
+		return nil, err
+	}
+	if err := *treeErrptr; err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// Reader reconstructs the original byte stream from a hashsplit tree
+// whose leaf chunks have been saved aside to a [ChunkStore],
+// e.g. by [Build].
+// Create one with [NewReader].
+//
+// Reader implements io.ReadSeekCloser.
+// Seeking is O(log N) in the number of nodes at each level of the tree
+// (see [Seek]),
+// and only the level-0 node overlapping the current position
+// is ever fetched from store.
+type Reader struct {
+	root  *TreeNode
+	store ChunkStore
+	pos   uint64
+
+	// cur and buf cache the level-0 node (and its assembled bytes)
+	// that most recently satisfied a Read, to avoid re-fetching on every call.
+	cur *TreeNode
+	buf []byte
+}
+
+// NewReader returns a Reader that reconstructs the stream represented by root,
+// fetching leaf chunks from store as needed.
+func NewReader(root *TreeNode, store ChunkStore) io.ReadSeekCloser {
+	return &Reader{root: root, store: store}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.pos >= r.root.Size {
+		return 0, io.EOF
+	}
+	if err := r.fill(); err != nil {
+		return 0, err
+	}
+	off := int(r.pos - r.cur.Offset)
+	n := copy(p, r.buf[off:])
+	r.pos += uint64(n)
+	return n, nil
+}
+
+// fill ensures r.cur and r.buf describe the level-0 node covering r.pos,
+// fetching it from r.store if it isn't already cached.
+func (r *Reader) fill() error {
+	if r.cur != nil && r.pos >= r.cur.Offset && r.pos < r.cur.Offset+r.cur.Size {
+		return nil
+	}
+
+	node, err := Seek(r.root, r.pos)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, node.Size)
+	for _, key := range node.Chunks {
+		chunk, err := r.store.Get(key)
+		if err != nil {
+			return fmt.Errorf("fetching chunk: %w", err)
+		}
+		buf = append(buf, chunk...)
+	}
+
+	r.cur, r.buf = node, buf
+	return nil
+}
+
+// Seek implements io.Seeker.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = int64(r.pos) + offset
+	case io.SeekEnd:
+		newPos = int64(r.root.Size) + offset
+	default:
+		return 0, fmt.Errorf("hashsplit: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, errors.New("hashsplit: negative seek position")
+	}
+	r.pos = uint64(newPos)
+	return newPos, nil
+}
+
+// Close implements io.Closer. It is a no-op.
+func (r *Reader) Close() error {
+	return nil
+}
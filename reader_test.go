@@ -0,0 +1,63 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// mapStore is a trivial in-memory ChunkStore keyed by content hash, for tests.
+type mapStore map[string][]byte
+
+func (m mapStore) Get(key []byte) ([]byte, error) {
+	chunk, ok := m[string(key)]
+	if !ok {
+		return nil, fmt.Errorf("no chunk for key %x", key)
+	}
+	return chunk, nil
+}
+
+func (m mapStore) Put(chunk []byte) ([]byte, error) {
+	sum := sha256.Sum256(chunk)
+	key := sum[:]
+	m[string(key)] = chunk
+	return key, nil
+}
+
+func TestReader(t *testing.T) {
+	text := genText()
+
+	store := make(mapStore)
+	root, err := Build(context.Background(), bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(root, store)
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, text) {
+		t.Fatalf("got %d bytes, want %d bytes; content mismatch", len(got), len(text))
+	}
+
+	for _, pos := range []int64{0, 1000, int64(len(text) / 2), int64(len(text) - 1)} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("seeking to %d: %v", pos, err)
+		}
+		buf := make([]byte, 10)
+		n, err := r.Read(buf)
+		if err != nil && err != io.EOF {
+			t.Fatalf("reading at %d: %v", pos, err)
+		}
+		if !bytes.Equal(buf[:n], text[pos:int(pos)+n]) {
+			t.Errorf("at pos %d: got %q, want %q", pos, buf[:n], text[pos:int(pos)+n])
+		}
+	}
+}
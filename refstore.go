@@ -0,0 +1,328 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// Ref identifies a node stored in a [BlobStore], typically a content hash.
+type Ref []byte
+
+// BlobStore persists the serialized nodes of a content-addressed hashsplit
+// tree (see [BuildRefTree]), keyed by content so that identical subtrees --
+// produced, for example, by two mostly-identical input streams -- collapse
+// to the same Ref. Unlike a tree of [TreeNode]s, a tree built against a
+// BlobStore need never be entirely in memory at once: only the node
+// currently being visited, plus the Refs of its ancestors, are needed.
+type BlobStore interface {
+	// Put stores data and returns the Ref under which Get can later retrieve it.
+	Put(ctx context.Context, data []byte) (Ref, error)
+
+	// Get returns the data previously stored under ref.
+	Get(ctx context.Context, ref Ref) ([]byte, error)
+}
+
+// MapStore is an in-memory [BlobStore], keyed by the SHA-256 hash of the
+// stored data. It's meant for tests; a real BlobStore would persist to
+// disk or a network service instead.
+type MapStore map[string][]byte
+
+// Put implements [BlobStore].
+func (m MapStore) Put(_ context.Context, data []byte) (Ref, error) {
+	sum := sha256.Sum256(data)
+	ref := Ref(sum[:])
+	m[string(ref)] = bytes.Clone(data)
+	return ref, nil
+}
+
+// Get implements [BlobStore].
+func (m MapStore) Get(_ context.Context, ref Ref) ([]byte, error) {
+	data, ok := m[string(ref)]
+	if !ok {
+		return nil, fmt.Errorf("hashsplit: ref %x not found", []byte(ref))
+	}
+	return data, nil
+}
+
+// RefNode is [TreeNode]'s content-addressed counterpart: a node in a
+// hashsplit tree that references its children by [Ref], fetched from a
+// [BlobStore] on demand, rather than by pointer.
+type RefNode struct {
+	// Offset and Size describe the range of the original input stream encompassed by this node.
+	Offset, Size uint64
+
+	// ChildRefs is the list of subnode refs for a node at level N>0.
+	// This list is empty for level 0 nodes.
+	ChildRefs []Ref
+
+	// Chunks is the list of chunks for a node at level 0.
+	// This list is empty for nodes at higher levels.
+	Chunks [][]byte
+}
+
+// refNodeFormatVersion is the version byte written by [RefNode.MarshalBinary]
+// and checked by [RefNode.UnmarshalBinary]. It's independent of
+// [treeFormatVersion]: the two are different wire formats.
+const refNodeFormatVersion = 1
+
+// MarshalBinary encodes n alone (not its descendants, which are reachable
+// only by fetching their Refs from the store) in a format suitable for
+// storage in a [BlobStore] and later decoding with UnmarshalBinary.
+func (n *RefNode) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(refNodeFormatVersion)
+	putUint64(&buf, n.Offset)
+	putUint64(&buf, n.Size)
+
+	if len(n.ChildRefs) == 0 {
+		buf.WriteByte(nodeKindLeaf)
+		putUvarint(&buf, uint64(len(n.Chunks)))
+		for _, chunk := range n.Chunks {
+			putUvarint(&buf, uint64(len(chunk)))
+			buf.Write(chunk)
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteByte(nodeKindInterior)
+	putUvarint(&buf, uint64(len(n.ChildRefs)))
+	for _, ref := range n.ChildRefs {
+		putUvarint(&buf, uint64(len(ref)))
+		buf.Write(ref)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a node previously encoded with MarshalBinary,
+// replacing n's contents with the decoded node's.
+func (n *RefNode) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading format version: %w", err)
+	}
+	if version != refNodeFormatVersion {
+		return fmt.Errorf("hashsplit: unsupported ref node format version %d", version)
+	}
+
+	offset, err := getUint64(r)
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading offset: %w", err)
+	}
+	size, err := getUint64(r)
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading size: %w", err)
+	}
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("hashsplit: reading node kind: %w", err)
+	}
+
+	decoded := RefNode{Offset: offset, Size: size}
+
+	switch kind {
+	case nodeKindLeaf:
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("hashsplit: reading chunk count: %w", err)
+		}
+		for i := uint64(0); i < count; i++ {
+			chunk, err := readChunk(r, 0)
+			if err != nil {
+				return fmt.Errorf("hashsplit: reading chunk %d: %w", i, err)
+			}
+			decoded.Chunks = append(decoded.Chunks, chunk)
+		}
+
+	case nodeKindInterior:
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return fmt.Errorf("hashsplit: reading child count: %w", err)
+		}
+		for i := uint64(0); i < count; i++ {
+			ref, err := readChunk(r, 0)
+			if err != nil {
+				return fmt.Errorf("hashsplit: reading child ref %d: %w", i, err)
+			}
+			decoded.ChildRefs = append(decoded.ChildRefs, Ref(ref))
+		}
+
+	default:
+		return fmt.Errorf("hashsplit: unknown node kind %d", kind)
+	}
+
+	if r.Len() != 0 {
+		return fmt.Errorf("hashsplit: %d trailing bytes after node", r.Len())
+	}
+
+	*n = decoded
+	return nil
+}
+
+// fetchRefNode retrieves and decodes the node stored under ref.
+func fetchRefNode(ctx context.Context, store BlobStore, ref Ref) (*RefNode, error) {
+	data, err := store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: fetching node %x: %w", []byte(ref), err)
+	}
+	var n RefNode
+	if err := n.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("hashsplit: decoding node %x: %w", []byte(ref), err)
+	}
+	return &n, nil
+}
+
+// BuildRefTree hashsplits r and stores the resulting tree in store,
+// one node at a time, as the content-addressed counterpart to [Build]:
+// where Build keeps the whole tree in memory as a [TreeNode] and saves
+// aside only the leaf chunks, BuildRefTree saves aside every node,
+// leaf and interior alike, and returns only the Ref of the root.
+//
+// Because each node is stored as soon as it's complete, BuildRefTree never
+// holds more of the tree in memory than [Tree] itself does in building it,
+// and two calls that produce an identical subtree -- e.g. from two mostly-
+// identical inputs -- store it once, under the same Ref.
+//
+// BuildRefTree honors ctx exactly as [Build] does.
+func BuildRefTree(ctx context.Context, r io.Reader, store BlobStore) (Ref, error) {
+	split, errptr := Split(ctx, r)
+	tree, treeErrptr := Tree(ctx, split)
+
+	refs := make(map[*TreeNode]Ref)
+
+	var root Ref
+	for node := range tree {
+		rn := RefNode{Offset: node.Offset, Size: node.Size, Chunks: node.Chunks}
+		for _, child := range node.Children {
+			ref, ok := refs[child]
+			if !ok {
+				return nil, fmt.Errorf("hashsplit: internal error: child node stored out of order")
+			}
+			rn.ChildRefs = append(rn.ChildRefs, ref)
+		}
+
+		data, err := rn.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		ref, err := store.Put(ctx, data)
+		if err != nil {
+			return nil, fmt.Errorf("hashsplit: storing node: %w", err)
+		}
+
+		refs[node] = ref
+		root = ref
+	}
+	if err := *errptr; err != nil {
+		return nil, err
+	}
+	if err := *treeErrptr; err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// RefAllChunks is the content-addressed counterpart to [TreeNode.AllChunks]:
+// it returns an iterator over all the chunks reachable from ref, fetching
+// each node from store as the traversal reaches it.
+//
+// After consuming the returned iterator, the caller should dereference the
+// returned error pointer to see whether a fetch from store failed.
+func RefAllChunks(ctx context.Context, store BlobStore, ref Ref) (iter.Seq[[]byte], *error) {
+	var err error
+
+	f := func(yield func([]byte) bool) {
+		var walk func(Ref) bool
+		walk = func(ref Ref) bool {
+			node, e := fetchRefNode(ctx, store, ref)
+			if e != nil {
+				err = e
+				return false
+			}
+			for _, chunk := range node.Chunks {
+				if !yield(chunk) {
+					return false
+				}
+			}
+			for _, child := range node.ChildRefs {
+				if !walk(child) {
+					return false
+				}
+			}
+			return true
+		}
+		walk(ref)
+	}
+
+	return f, &err
+}
+
+// RefPre is the content-addressed counterpart to [TreeNode.Pre]: a preorder
+// iterator over the node stored under ref and all its descendants, fetching
+// each one from store as the traversal reaches it.
+//
+// After consuming the returned iterator, the caller should dereference the
+// returned error pointer to see whether a fetch from store failed.
+func RefPre(ctx context.Context, store BlobStore, ref Ref) (iter.Seq[*RefNode], *error) {
+	var err error
+
+	f := func(yield func(*RefNode) bool) {
+		var walk func(Ref) bool
+		walk = func(ref Ref) bool {
+			node, e := fetchRefNode(ctx, store, ref)
+			if e != nil {
+				err = e
+				return false
+			}
+			if !yield(node) {
+				return false
+			}
+			for _, child := range node.ChildRefs {
+				if !walk(child) {
+					return false
+				}
+			}
+			return true
+		}
+		walk(ref)
+	}
+
+	return f, &err
+}
+
+// RefSeek is the content-addressed counterpart to [Seek]: it finds the
+// level-0 node representing the given byte position, fetching from store
+// the nodes on the path from ref down to it. Since a node's ChildRefs carry
+// no offsets, at each level it also fetches every child before the one it
+// descends into, to read its range.
+func RefSeek(ctx context.Context, store BlobStore, ref Ref, pos uint64) (*RefNode, error) {
+	node, err := fetchRefNode(ctx, store, ref)
+	if err != nil {
+		return nil, err
+	}
+	if pos < node.Offset || pos >= node.Offset+node.Size {
+		return nil, ErrNotFound
+	}
+	if len(node.ChildRefs) == 0 {
+		return node, nil
+	}
+
+	for _, childRef := range node.ChildRefs {
+		child, err := fetchRefNode(ctx, store, childRef)
+		if err != nil {
+			return nil, err
+		}
+		if pos < child.Offset+child.Size {
+			return RefSeek(ctx, store, childRef, pos)
+		}
+	}
+	// With a properly formed tree of nodes this will not be reached.
+	return nil, ErrNotFound
+}
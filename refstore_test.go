@@ -0,0 +1,138 @@
+package hashsplit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestTreeNodePre(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	split, errptr := Split(ctx, bytes.NewReader(text))
+	tree, treeErrptr := Tree(ctx, split)
+	root := Root(tree)
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if err := *treeErrptr; err != nil {
+		t.Fatal(err)
+	}
+
+	var nodes, leaves int
+	for node := range root.Pre() {
+		nodes++
+		if len(node.Children) == 0 {
+			leaves++
+		}
+	}
+	if nodes == 0 {
+		t.Fatal("Pre visited no nodes")
+	}
+	if leaves == 0 {
+		t.Fatal("Pre visited no leaf nodes")
+	}
+	// The root itself must be the first node visited.
+	first, ok := rootFirst(root)
+	if !ok || first != root {
+		t.Fatal("Pre did not visit the root first")
+	}
+}
+
+func rootFirst(root *TreeNode) (*TreeNode, bool) {
+	for node := range root.Pre() {
+		return node, true
+	}
+	return nil, false
+}
+
+func TestBuildRefTree(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	store := make(MapStore)
+	root, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	chunks, errptr := RefAllChunks(ctx, store, root)
+	for chunk := range chunks {
+		got.Write(chunk)
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got.Bytes(), text) {
+		t.Fatal("reconstructed content does not match original")
+	}
+}
+
+func TestBuildRefTreeDedupes(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	store := make(MapStore)
+	root1, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizeAfterFirst := len(store)
+
+	root2, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(root1, root2) {
+		t.Fatal("building the same content twice produced different root refs")
+	}
+	if len(store) != sizeAfterFirst {
+		t.Fatalf("got %d entries in store after rebuilding identical content, want %d", len(store), sizeAfterFirst)
+	}
+}
+
+func TestRefSeekAndPre(t *testing.T) {
+	ctx := context.Background()
+	text := genText()
+
+	store := make(MapStore)
+	root, err := BuildRefTree(ctx, bytes.NewReader(text), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootNode, err := fetchRefNode(ctx, store, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := RefSeek(ctx, store, root, rootNode.Size/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.ChildRefs) != 0 {
+		t.Fatal("RefSeek did not return a level-0 node")
+	}
+
+	var sawLeaves int
+	nodes, errptr := RefPre(ctx, store, root)
+	for node := range nodes {
+		if len(node.ChildRefs) == 0 {
+			sawLeaves++
+		}
+	}
+	if err := *errptr; err != nil {
+		t.Fatal(err)
+	}
+	if sawLeaves == 0 {
+		t.Fatal("RefPre visited no leaf nodes")
+	}
+
+	if _, err := RefSeek(ctx, store, root, rootNode.Size); err != ErrNotFound {
+		t.Fatalf("got err %v seeking past the end, want ErrNotFound", err)
+	}
+}
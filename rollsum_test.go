@@ -56,6 +56,10 @@ func BenchmarkRollsum(b *testing.B) {
 			name:   "rabinkarp64",
 			roller: newRabinKarp64(64),
 		},
+		{
+			name:   "fastcdc",
+			roller: newFastCDCRoller(),
+		},
 	}
 
 	for _, tt := range tests {
@@ -248,3 +252,24 @@ func (w *rabinkarp64wrapper) Roll(b byte) {
 func (w *rabinkarp64wrapper) Digest() uint32 {
 	return uint32(w.r.Sum64())
 }
+
+// fastcdc
+//
+// Unlike the rollinghash-based wrappers above, the gear hash has no
+// window to prime with an initial Write -- see the comment on gearTable.
+
+type fastCDCRollerWrapper struct {
+	f *fastCDC
+}
+
+func newFastCDCRoller() roller {
+	return &fastCDCRollerWrapper{f: newFastCDC(0, 1<<defaultSplitBits, 0, defaultSplitBits)}
+}
+
+func (w *fastCDCRollerWrapper) Roll(b byte) {
+	w.f.roll(b)
+}
+
+func (w *fastCDCRollerWrapper) Digest() uint32 {
+	return uint32(w.f.h)
+}
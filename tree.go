@@ -1,46 +1,166 @@
 package hashsplit
 
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+)
+
+// TreeBuilder builds a hashsplit tree incrementally from a sequence of
+// chunk/level pairs, the same as the free function [Tree],
+// but keeps its in-progress state -- the pending, not-yet-closed node
+// at each level -- in a value the caller can inspect and checkpoint
+// between calls.
+//
+// Use a TreeBuilder instead of [Tree] when a tree needs to be resumable
+// across a crash, alongside [Splitter.Checkpoint] and [Splitter.SplitResumable]:
+// save the pending levels with [TreeCheckpoint] at a safe point,
+// and reconstruct a TreeBuilder from them later with [RestoreTreeBuilder].
+//
+// The zero value is not ready to use; create one with [NewTreeBuilder].
 type TreeBuilder struct {
-	// ChunkFunc maps each incoming chunk to a new byte slice
-	// (which can be the original bytes, or a hash of them, or anything else)
-	// and a level.
-	//
-	// On a separate note, saying "ChunkFunc func(Chunk)" out loud is fun.
-	ChunkFunc func(Chunk) ([]byte, int)
+	levels []*TreeNode
+}
+
+// NewTreeBuilder returns a TreeBuilder ready to build a new tree from scratch.
+func NewTreeBuilder() *TreeBuilder {
+	return &TreeBuilder{levels: []*TreeNode{{}}}
 }
 
-type Node struct {
-	Level  int
-	Nodes  []*Node
-	Leaves [][]byte
+// Pending returns the not-yet-closed node at each level of the tree under
+// construction, level 0 first. Save it with [TreeCheckpoint] to resume
+// building later; see [RestoreTreeBuilder].
+func (b *TreeBuilder) Pending() []*TreeNode {
+	return b.levels
 }
 
-func (s *TreeBuilder) Tree(inp <-chan Chunk) <-chan *Node {
-	out := make(chan *Node)
-	levels := []*Node{&Node{Level: 0}}
+// Tree consumes inp and produces an iterator of tree node/level pairs,
+// continuing from (and updating) b's in-progress state instead of starting
+// a tree from scratch. See the free function [Tree] for the full
+// explanation of the iterator's behavior; the two differ only in where
+// the in-progress level stack comes from.
+//
+// Tree honors ctx: if it's canceled before inp is exhausted, Tree stops
+// consuming inp and yielding promptly, leaving b's in-progress state as it
+// was at the last completed step, and the returned error is ctx.Err().
+func (b *TreeBuilder) Tree(ctx context.Context, inp iter.Seq2[[]byte, int]) (iter.Seq2[*TreeNode, int], *error) {
+	var err error
+
+	f := func(yield func(*TreeNode, int) bool) {
+		levels := b.levels
+		defer func() { b.levels = levels }()
 
-	go func() {
-		defer close(out)
-		for chunk := range inp {
-			b, level := s.ChunkFunc(chunk)
-			levels[0].Leaves = append(levels[0].Leaves, b)
+		for chunk, level := range inp {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				err = ctxErr
+				return
+			}
+
+			levels[0].Chunks = append(levels[0].Chunks, chunk)
+			for _, n := range levels {
+				n.Size += uint64(len(chunk))
+			}
 			for i := 0; i < level; i++ {
 				if i == len(levels)-1 {
-					levels = append(levels, &Node{Level: i + 1})
+					levels = append(levels, &TreeNode{
+						Size: levels[i].Size,
+					})
+				}
+
+				n := levels[i]
+				levels[i+1].Children = append(levels[i+1].Children, n)
+
+				if !yield(n, i) {
+					return
+				}
+
+				levels[i] = &TreeNode{
+					Offset: levels[i+1].Offset + levels[i+1].Size,
 				}
-				levels[i+1].Nodes = append(levels[i+1].Nodes, levels[i])
-				out <- levels[i]
-				levels[i] = &Node{Level: i}
 			}
 		}
-		if len(levels[0].Leaves) > 0 {
-			for i := 0; i < len(levels)-1; i++ {
-				levels[i+1].Nodes = append(levels[i+1].Nodes, levels[i])
-				out <- levels[i]
+
+		if len(levels[0].Chunks) == 0 {
+			return
+		}
+
+		// Link and yield copies of the pending nodes,
+		// leaving b's own pending levels unlinked so that building can resume from them.
+		final := make([]*TreeNode, len(levels))
+		for i, n := range levels {
+			c := *n
+			c.Children = slices.Clone(n.Children)
+			c.Chunks = slices.Clone(n.Chunks)
+			final[i] = &c
+		}
+		for i := 0; i < len(final)-1; i++ {
+			final[i+1].Children = append(final[i+1].Children, final[i])
+		}
+
+		top := len(final) - 1
+		for top > 0 && len(final[top].Children) == 1 {
+			top--
+		}
+		for i := 0; i <= top; i++ {
+			if !yield(final[i], i) {
+				return
 			}
-			out <- levels[len(levels)-1]
 		}
-	}()
+	}
+
+	return f, &err
+}
+
+// TreeCheckpoint encodes the pending level stack of a TreeBuilder
+// (see [TreeBuilder.Pending]) so it can be restored later with
+// [RestoreTreeBuilder].
+func TreeCheckpoint(pending []*TreeNode) ([]byte, error) {
+	var buf bytes.Buffer
+
+	putUvarint(&buf, uint64(len(pending)))
+	for i, n := range pending {
+		data, err := n.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("hashsplit: encoding pending level %d: %w", i, err)
+		}
+		putUvarint(&buf, uint64(len(data)))
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// RestoreTreeBuilder reconstructs a TreeBuilder from a checkpoint produced
+// by [TreeCheckpoint], ready to resume building a tree from the point the
+// checkpoint was taken.
+func RestoreTreeBuilder(data []byte) (*TreeBuilder, error) {
+	r := bytes.NewReader(data)
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("hashsplit: reading pending level count: %w", err)
+	}
+
+	levels := make([]*TreeNode, count)
+	for i := range levels {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("hashsplit: reading pending level %d length: %w", i, err)
+		}
+		data := make([]byte, l)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("hashsplit: reading pending level %d: %w", i, err)
+		}
+		var n TreeNode
+		if err := n.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("hashsplit: decoding pending level %d: %w", i, err)
+		}
+		levels[i] = &n
+	}
 
-	return out
+	return &TreeBuilder{levels: levels}, nil
 }